@@ -0,0 +1,200 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ondi/go-cache"
+)
+
+// implemented by Storage_t and Sharded_t
+type SnapshotWriter interface {
+	WriteSnapshot(out io.Writer, ts time.Time) (err error)
+	Now() time.Time
+}
+
+type SnapshotHandler_t struct {
+	storage SnapshotWriter
+}
+
+// serves storage snapshot for Aggregator_t
+func NewSnapshotHandler(storage SnapshotWriter) *SnapshotHandler_t {
+	return &SnapshotHandler_t{
+		storage: storage,
+	}
+}
+
+func (self *SnapshotHandler_t) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	self.storage.WriteSnapshot(w, self.storage.Now())
+}
+
+type Peer_t struct {
+	Url       string
+	UpdateTs  time.Time // last successful fetch
+	Stale     bool
+	LastError error
+}
+
+type Aggregator_t[Key_t comparable] struct {
+	mx           sync.Mutex
+	client       *http.Client
+	peers        []*Peer_t
+	storage      *Storage_t[Key_t]
+	limit_pages  int
+	median_limit int
+	median_ttl   time.Duration
+	done         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// fetches snapshots from peers every interval, stale peers are excluded from merged view
+func NewAggregator[Key_t comparable](client *http.Client, peers []string, interval time.Duration, limit_pages int, median_limit int, median_ttl time.Duration) (self *Aggregator_t[Key_t]) {
+	self = &Aggregator_t[Key_t]{
+		client:       client,
+		limit_pages:  limit_pages,
+		median_limit: median_limit,
+		median_ttl:   median_ttl,
+		done:         make(chan struct{}),
+	}
+	self.storage = self.new_storage()
+	for _, v := range peers {
+		self.peers = append(self.peers, &Peer_t{Url: v, Stale: true})
+	}
+	if interval > 0 {
+		self.wg.Add(1)
+		go self.run(interval)
+	}
+	return
+}
+
+// rollups of peers are merged by class
+func (self *Aggregator_t[Key_t]) new_storage() (out *Storage_t[Key_t]) {
+	out = NewStorage(self.limit_pages, self.median_limit, self.median_ttl, NoEvict[Key_t])
+	out.SetRollup(nil)
+	return
+}
+
+func (self *Aggregator_t[Key_t]) run(interval time.Duration) {
+	defer self.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		self.Update(ctx, time.Now())
+		cancel()
+		select {
+		case <-self.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (self *Aggregator_t[Key_t]) Stop() {
+	close(self.done)
+	self.wg.Wait()
+}
+
+func (self *Aggregator_t[Key_t]) fetch(ctx context.Context, url string) (out StorageSnapshot_t[Key_t], err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%s: status %d", url, resp.StatusCode)
+		return
+	}
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	return
+}
+
+// fetches all peers and rebuilds merged view
+func (self *Aggregator_t[Key_t]) Update(ctx context.Context, ts time.Time) {
+	type result_t struct {
+		snapshot StorageSnapshot_t[Key_t]
+		err      error
+	}
+	res := make([]result_t, len(self.peers))
+	var wg sync.WaitGroup
+	for i, v := range self.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res[i].snapshot, res[i].err = self.fetch(ctx, v.Url)
+		}()
+	}
+	wg.Wait()
+
+	storage := self.new_storage()
+	self.mx.Lock()
+	for i, v := range self.peers {
+		if v.LastError = res[i].err; v.LastError == nil {
+			v.LastError = storage.Merge(res[i].snapshot)
+		}
+		if v.Stale = v.LastError != nil; v.Stale == false {
+			v.UpdateTs = ts
+		}
+	}
+	self.storage = storage
+	self.mx.Unlock()
+}
+
+func (self *Aggregator_t[Key_t]) Peers() (out []Peer_t) {
+	self.mx.Lock()
+	for _, v := range self.peers {
+		out = append(out, *v)
+	}
+	self.mx.Unlock()
+	return
+}
+
+func (self *Aggregator_t[Key_t]) view() (out *Storage_t[Key_t]) {
+	self.mx.Lock()
+	out = self.storage
+	self.mx.Unlock()
+	return
+}
+
+func (self *Aggregator_t[Key_t]) HitGet(ts time.Time, name Key_t) (out Result_t, ok bool) {
+	return self.view().HitGet(ts, name)
+}
+
+func (self *Aggregator_t[Key_t]) Range(ts time.Time, f func(name Key_t, res Result_t) bool) {
+	self.view().Range(ts, f)
+}
+
+func (self *Aggregator_t[Key_t]) RangeSort(ts time.Time, order cache.Less_t[Key_t, *Counter_t], f func(name Key_t, res Result_t) bool) {
+	self.view().RangeSort(ts, order, f)
+}
+
+func (self *Aggregator_t[Key_t]) All(ts time.Time) iter.Seq2[Key_t, Result_t] {
+	return self.view().All(ts)
+}
+
+func (self *Aggregator_t[Key_t]) HitStatRollup(ts time.Time, class string) (out Stat_t, ok bool) {
+	return self.view().HitStatRollup(ts, class)
+}
+
+func (self *Aggregator_t[Key_t]) HitGetRollup(ts time.Time, class string) (out Result_t, ok bool) {
+	return self.view().HitGetRollup(ts, class)
+}
+
+func (self *Aggregator_t[Key_t]) RangeRollup(ts time.Time, f func(class string, res Stat_t) bool) {
+	self.view().RangeRollup(ts, f)
+}
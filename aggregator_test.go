@@ -0,0 +1,78 @@
+//
+// go test -run Test_Aggregator -v -count=1
+//
+
+package ministat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Aggregator01(t *testing.T) {
+	ts := time.Now()
+	s1 := NewStorage(100, 100, 10*time.Second, NoEvict[Page_t])
+	s2 := NewStorage(100, 100, 10*time.Second, NoEvict[Page_t])
+	s1.SetRollup(PageEntry)
+	s2.SetRollup(PageEntry)
+	for i := 0; i < 3; i++ {
+		counter, _, _, _ := s1.HitBegin(Page_t{Name: "/page"}, ts)
+		s1.HitEnd(counter, ts, ts.Add(time.Millisecond), nil)
+	}
+	counter, _, _, _ := s2.HitBegin(Page_t{Name: "/page"}, ts)
+	s2.HitEnd(counter, ts, ts.Add(time.Millisecond), nil)
+
+	peer1 := httptest.NewServer(NewSnapshotHandler(s1))
+	defer peer1.Close()
+	peer2 := httptest.NewServer(NewSnapshotHandler(s2))
+	peer3 := httptest.NewServer(http.NotFoundHandler())
+	defer peer3.Close()
+
+	a := NewAggregator[Page_t](peer1.Client(), []string{peer1.URL, peer2.URL, peer3.URL}, 0, 100, 100, 10*time.Second)
+	a.Update(context.Background(), ts)
+
+	res, ok := a.HitGet(ts, Page_t{Name: "/page"})
+	assert.Assert(t, ok)
+	assert.Assert(t, res.GaugeCurrent[1].GetValueInt64() == 4, res.GaugeCurrent)
+	total, ok := a.HitStatRollup(ts, ROLLUP_TOTAL)
+	assert.Assert(t, ok && total.Hits == 4, total)
+
+	peers := a.Peers()
+	assert.Assert(t, peers[0].Stale == false, peers[0])
+	assert.Assert(t, peers[1].Stale == false, peers[1])
+	assert.Assert(t, peers[2].Stale == true, peers[2])
+
+	peer2.Close()
+	a.Update(context.Background(), ts)
+
+	res, ok = a.HitGet(ts, Page_t{Name: "/page"})
+	assert.Assert(t, ok)
+	assert.Assert(t, res.GaugeCurrent[1].GetValueInt64() == 3, res.GaugeCurrent)
+
+	peers = a.Peers()
+	assert.Assert(t, peers[1].Stale == true, peers[1])
+	assert.Assert(t, peers[1].UpdateTs.Equal(ts), peers[1])
+}
+
+// sharded peer
+func Test_Aggregator02(t *testing.T) {
+	s := NewSharded(4, 100, 100, 10*time.Second, NoEvict[string])
+	s.HitBegin("page", time.Now())
+	peer := httptest.NewServer(NewSnapshotHandler(s))
+	defer peer.Close()
+
+	a := NewAggregator[string](peer.Client(), []string{peer.URL}, 10*time.Millisecond, 100, 100, 10*time.Second)
+	defer a.Stop()
+	for i := 0; i < 100; i++ {
+		if _, ok := a.HitGet(time.Now(), "page"); ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("page not found")
+}
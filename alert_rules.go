@@ -0,0 +1,148 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"sync"
+	"time"
+)
+
+// implemented by Storage_t, Sharded_t
+type Stats[Key_t comparable] interface {
+	HitStat(ts time.Time, name Key_t) (out Stat_t, ok bool)
+}
+
+// fires when gauge value > Fire during For, resolves when value <= Resolve.
+// Resolve <= Fire gives hysteresis, durations are compared in nanoseconds.
+type Rule_t[Key_t comparable] struct {
+	Name    string
+	Page    Key_t
+	Gauge   string // name of gauge from Stat_t.GaugeCurrent
+	Level   string // tag only
+	Tag     string // tag only
+	Fire    float64
+	Resolve float64
+	For     time.Duration
+}
+
+type Alert_t[Key_t comparable] struct {
+	Rule   Rule_t[Key_t]
+	Value  float64
+	Ts     time.Time
+	Firing bool
+}
+
+type Fire_t[Key_t comparable] func(alert Alert_t[Key_t])
+
+type rule_state_t[Key_t comparable] struct {
+	Rule_t[Key_t]
+	above_ts time.Time
+	firing   bool
+}
+
+type Rules_t[Key_t comparable] struct {
+	mx         sync.Mutex
+	storage    Stats[Key_t]
+	rules      []*rule_state_t[Key_t]
+	on_fire    Fire_t[Key_t]
+	on_resolve Fire_t[Key_t]
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// evaluates rules every interval until Stop, interval 0 = call Evaluate manually
+func NewRules[Key_t comparable](storage Stats[Key_t], interval time.Duration, on_fire Fire_t[Key_t], on_resolve Fire_t[Key_t]) (self *Rules_t[Key_t]) {
+	self = &Rules_t[Key_t]{
+		storage:    storage,
+		on_fire:    on_fire,
+		on_resolve: on_resolve,
+		done:       make(chan struct{}),
+	}
+	if interval > 0 {
+		self.wg.Add(1)
+		go self.run(interval)
+	}
+	return
+}
+
+func (self *Rules_t[Key_t]) run(interval time.Duration) {
+	defer self.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.done:
+			return
+		case ts := <-ticker.C:
+			self.Evaluate(ts)
+		}
+	}
+}
+
+func (self *Rules_t[Key_t]) Stop() {
+	close(self.done)
+	self.wg.Wait()
+}
+
+func (self *Rules_t[Key_t]) Add(rule Rule_t[Key_t]) {
+	self.mx.Lock()
+	self.rules = append(self.rules, &rule_state_t[Key_t]{Rule_t: rule})
+	self.mx.Unlock()
+}
+
+// rules of evicted pages keep their state
+func (self *Rules_t[Key_t]) Evaluate(ts time.Time) {
+	var fired, resolved []Alert_t[Key_t]
+	self.mx.Lock()
+	for _, v := range self.rules {
+		res, ok := self.storage.HitStat(ts, v.Page)
+		if ok == false {
+			continue
+		}
+		value, ok := res.Value(v.Gauge, v.Level, v.Tag)
+		if ok == false {
+			continue
+		}
+		alert := Alert_t[Key_t]{Rule: v.Rule_t, Value: value, Ts: ts}
+		if v.firing {
+			if value <= v.Resolve {
+				v.firing = false
+				v.above_ts = time.Time{}
+				resolved = append(resolved, alert)
+			}
+			continue
+		}
+		if value <= v.Fire {
+			v.above_ts = time.Time{}
+			continue
+		}
+		if v.above_ts.IsZero() {
+			v.above_ts = ts
+		}
+		if ts.Sub(v.above_ts) >= v.For {
+			v.firing = true
+			alert.Firing = true
+			fired = append(fired, alert)
+		}
+	}
+	self.mx.Unlock()
+	for _, v := range fired {
+		self.on_fire(v)
+	}
+	for _, v := range resolved {
+		self.on_resolve(v)
+	}
+}
+
+func (self *Rules_t[Key_t]) Firing() (out []Rule_t[Key_t]) {
+	self.mx.Lock()
+	for _, v := range self.rules {
+		if v.firing {
+			out = append(out, v.Rule_t)
+		}
+	}
+	self.mx.Unlock()
+	return
+}
@@ -0,0 +1,62 @@
+//
+// go test -run Test_Rules -v -count=1
+//
+
+package ministat
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Rules01(t *testing.T) {
+	s := NewStorage(10, 10, 10*time.Second, NoEvict[string])
+	var fired, resolved []Alert_t[string]
+	rules := NewRules[string](s, 0,
+		func(alert Alert_t[string]) { fired = append(fired, alert) },
+		func(alert Alert_t[string]) { resolved = append(resolved, alert) },
+	)
+	rules.Add(Rule_t[string]{Name: "pending", Page: "/api/search", Gauge: "pending", Fire: 2, Resolve: 0, For: 30 * time.Second})
+
+	ts := time.Now()
+	var counters []*Counter_t
+	for i := 0; i < 3; i++ {
+		counter, _, _, _ := s.HitBegin("/api/search", ts)
+		counters = append(counters, counter)
+	}
+	rules.Evaluate(ts)
+	assert.Assert(t, len(fired) == 0, fired)
+
+	rules.Evaluate(ts.Add(30 * time.Second))
+	assert.Assert(t, len(fired) == 1, fired)
+	assert.Assert(t, fired[0].Value == 3 && fired[0].Firing, fired[0])
+	assert.Assert(t, len(rules.Firing()) == 1)
+
+	// hysteresis
+	s.HitEnd(counters[0], ts, ts, nil)
+	s.HitEnd(counters[1], ts, ts, nil)
+	rules.Evaluate(ts.Add(40 * time.Second))
+	assert.Assert(t, len(resolved) == 0, resolved)
+
+	s.HitEnd(counters[2], ts, ts, nil)
+	rules.Evaluate(ts.Add(50 * time.Second))
+	assert.Assert(t, len(resolved) == 1, resolved)
+	assert.Assert(t, resolved[0].Value == 0 && resolved[0].Firing == false, resolved[0])
+	assert.Assert(t, len(fired) == 1, fired)
+	assert.Assert(t, len(rules.Firing()) == 0)
+}
+
+func Test_Rules02(t *testing.T) {
+	s := NewStorage(10, 10, 10*time.Second, NoEvict[string])
+	var fired []Alert_t[string]
+	rules := NewRules[string](s, 0, func(alert Alert_t[string]) { fired = append(fired, alert) }, func(Alert_t[string]) {})
+	rules.Add(Rule_t[string]{Page: "page", Gauge: "latency/med", Fire: float64(300 * time.Millisecond), Resolve: float64(200 * time.Millisecond)})
+
+	ts := time.Now()
+	counter, _, _, _ := s.HitBegin("page", ts)
+	s.HitEnd(counter, ts, ts.Add(400*time.Millisecond), nil)
+	rules.Evaluate(ts)
+	assert.Assert(t, len(fired) == 1, fired)
+}
@@ -0,0 +1,167 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type AlertPayload_t[Key_t comparable] struct {
+	Name      string    `json:"name,omitzero"`
+	Page      Key_t     `json:"page"`
+	Metric    string    `json:"metric"`
+	Level     string    `json:"level,omitzero"`
+	Tag       string    `json:"tag,omitzero"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	State     string    `json:"state"` // firing, resolved
+	Ts        time.Time `json:"ts"`
+}
+
+type alert_key_t[Key_t comparable] struct {
+	page  Key_t
+	name  string
+	gauge string
+	level string
+	tag   string
+}
+
+type alert_sent_t struct {
+	firing  bool
+	fire_ts time.Time
+}
+
+type Webhook_t[Key_t comparable] struct {
+	mx          sync.Mutex
+	wg          sync.WaitGroup
+	client      *http.Client
+	urls        []string
+	retries     int
+	retry_delay time.Duration
+	timeout     time.Duration
+	dedup       time.Duration
+	log_write   LogWrite_t
+	sent        map[alert_key_t[Key_t]]alert_sent_t
+}
+
+// OnFire and OnResolve are Fire_t for NewRules.
+// firing is not sent again until resolved or within dedup after previous firing,
+// resolve is sent only for sent firing. delivery is retried with retry_delay*attempt,
+// every attempt is limited by timeout, 0 = no timeout. log_write may be nil.
+func NewWebhook[Key_t comparable](client *http.Client, urls []string, retries int, retry_delay time.Duration, timeout time.Duration, dedup time.Duration, log_write LogWrite_t) *Webhook_t[Key_t] {
+	return &Webhook_t[Key_t]{
+		client:      client,
+		urls:        urls,
+		retries:     retries,
+		retry_delay: retry_delay,
+		timeout:     timeout,
+		dedup:       dedup,
+		log_write:   log_write,
+		sent:        map[alert_key_t[Key_t]]alert_sent_t{},
+	}
+}
+
+func (self *Webhook_t[Key_t]) OnFire(alert Alert_t[Key_t]) {
+	key := alert_key_t[Key_t]{page: alert.Rule.Page, name: alert.Rule.Name, gauge: alert.Rule.Gauge, level: alert.Rule.Level, tag: alert.Rule.Tag}
+	self.mx.Lock()
+	sent, ok := self.sent[key]
+	if ok && (sent.firing || alert.Ts.Sub(sent.fire_ts) < self.dedup) {
+		self.mx.Unlock()
+		return
+	}
+	self.sent[key] = alert_sent_t{firing: true, fire_ts: alert.Ts}
+	self.mx.Unlock()
+	self.send(alert, "firing", alert.Rule.Fire)
+}
+
+func (self *Webhook_t[Key_t]) OnResolve(alert Alert_t[Key_t]) {
+	key := alert_key_t[Key_t]{page: alert.Rule.Page, name: alert.Rule.Name, gauge: alert.Rule.Gauge, level: alert.Rule.Level, tag: alert.Rule.Tag}
+	self.mx.Lock()
+	sent := self.sent[key]
+	if sent.firing == false {
+		self.mx.Unlock()
+		return
+	}
+	sent.firing = false
+	self.sent[key] = sent
+	self.mx.Unlock()
+	self.send(alert, "resolved", alert.Rule.Resolve)
+}
+
+func (self *Webhook_t[Key_t]) send(alert Alert_t[Key_t], state string, threshold float64) {
+	body, err := json.Marshal(AlertPayload_t[Key_t]{
+		Name:      alert.Rule.Name,
+		Page:      alert.Rule.Page,
+		Metric:    alert.Rule.Gauge,
+		Level:     alert.Rule.Level,
+		Tag:       alert.Rule.Tag,
+		Value:     alert.Value,
+		Threshold: threshold,
+		State:     state,
+		Ts:        alert.Ts,
+	})
+	if err != nil {
+		self.log(context.Background(), "WEBHOOK: %v", err)
+		return
+	}
+	for _, url := range self.urls {
+		self.wg.Add(1)
+		go self.post(url, body)
+	}
+}
+
+func (self *Webhook_t[Key_t]) post(url string, body []byte) {
+	defer self.wg.Done()
+	var err error
+	for attempt := 0; attempt <= self.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(self.retry_delay * time.Duration(attempt))
+		}
+		if err = self.post_once(url, body); err == nil {
+			return
+		}
+	}
+	self.log(context.Background(), "WEBHOOK: %s, attempts=%d, %v", url, self.retries+1, err)
+}
+
+func (self *Webhook_t[Key_t]) log(ctx context.Context, format string, args ...any) {
+	if self.log_write != nil {
+		self.log_write(ctx, format, args...)
+	}
+}
+
+func (self *Webhook_t[Key_t]) post_once(url string, body []byte) (err error) {
+	ctx := context.Background()
+	if self.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, self.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return
+}
+
+// waits for deliveries in progress
+func (self *Webhook_t[Key_t]) Wait() {
+	self.wg.Wait()
+}
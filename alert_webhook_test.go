@@ -0,0 +1,103 @@
+//
+// go test -run Test_Webhook -v -count=1
+//
+
+package ministat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Webhook01(t *testing.T) {
+	var mx sync.Mutex
+	var requests int
+	var received []AlertPayload_t[string]
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+		// first delivery fails
+		if requests++; requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var payload AlertPayload_t[string]
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload)
+	}))
+	defer receiver.Close()
+
+	var errors []string
+	webhook := NewWebhook[string](receiver.Client(), []string{receiver.URL}, 2, time.Millisecond, time.Second, time.Minute,
+		func(ctx context.Context, format string, args ...any) { errors = append(errors, format) },
+	)
+
+	ts := time.Now()
+	rule := Rule_t[string]{Name: "search", Page: "/api/search", Gauge: "pending", Fire: 50, Resolve: 40}
+	webhook.OnFire(Alert_t[string]{Rule: rule, Value: 60, Ts: ts, Firing: true})
+	webhook.OnFire(Alert_t[string]{Rule: rule, Value: 70, Ts: ts, Firing: true})
+	webhook.Wait()
+	webhook.OnResolve(Alert_t[string]{Rule: rule, Value: 30, Ts: ts.Add(time.Second)})
+	webhook.Wait()
+	// flapping within dedup
+	webhook.OnFire(Alert_t[string]{Rule: rule, Value: 60, Ts: ts.Add(2 * time.Second), Firing: true})
+	webhook.OnResolve(Alert_t[string]{Rule: rule, Value: 30, Ts: ts.Add(3 * time.Second)})
+	webhook.Wait()
+
+	assert.Assert(t, len(errors) == 0, errors)
+	assert.Assert(t, requests == 3, requests)
+	assert.Assert(t, len(received) == 2, received)
+	assert.Assert(t, received[0].State == "firing" && received[0].Value == 60 && received[0].Threshold == 50, received[0])
+	assert.Assert(t, received[1].State == "resolved" && received[1].Value == 30 && received[1].Threshold == 40, received[1])
+	assert.Assert(t, received[0].Page == "/api/search" && received[0].Metric == "pending", received[0])
+}
+
+// hung receiver is limited by timeout, log_write is nil
+func Test_Webhook02(t *testing.T) {
+	done := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer receiver.Close()
+	defer close(done)
+
+	webhook := NewWebhook[string](receiver.Client(), []string{receiver.URL}, 1, time.Millisecond, 20*time.Millisecond, time.Minute, nil)
+	rule := Rule_t[string]{Name: "search", Page: "/api/search", Gauge: "pending", Fire: 50, Resolve: 40}
+	begin := time.Now()
+	webhook.OnFire(Alert_t[string]{Rule: rule, Value: 60, Ts: begin, Firing: true})
+	webhook.Wait()
+	assert.Assert(t, time.Since(begin) < 5*time.Second, time.Since(begin))
+}
+
+// timeout 0 is no timeout
+func Test_Webhook03(t *testing.T) {
+	var mx sync.Mutex
+	var requests int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		requests++
+		mx.Unlock()
+	}))
+	defer receiver.Close()
+
+	var errors []string
+	webhook := NewWebhook[string](receiver.Client(), []string{receiver.URL}, 1, time.Millisecond, 0, time.Minute,
+		func(ctx context.Context, format string, args ...any) { errors = append(errors, format) },
+	)
+	rule := Rule_t[string]{Name: "search", Page: "/api/search", Gauge: "pending", Fire: 50, Resolve: 40}
+	webhook.OnFire(Alert_t[string]{Rule: rule, Value: 60, Ts: time.Now(), Firing: true})
+	webhook.Wait()
+
+	assert.Assert(t, len(errors) == 0, errors)
+	assert.Assert(t, requests == 1, requests)
+}
@@ -0,0 +1,53 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+type SystemClock_t struct{}
+
+func (SystemClock_t) Now() time.Time {
+	return time.Now()
+}
+
+// for tests, time moves only by Add and Set
+type FakeClock_t struct {
+	mx sync.Mutex
+	ts time.Time
+}
+
+func NewFakeClock(ts time.Time) *FakeClock_t {
+	return &FakeClock_t{
+		ts: ts,
+	}
+}
+
+func (self *FakeClock_t) Now() (ts time.Time) {
+	self.mx.Lock()
+	ts = self.ts
+	self.mx.Unlock()
+	return
+}
+
+func (self *FakeClock_t) Add(d time.Duration) (ts time.Time) {
+	self.mx.Lock()
+	self.ts = self.ts.Add(d)
+	ts = self.ts
+	self.mx.Unlock()
+	return
+}
+
+func (self *FakeClock_t) Set(ts time.Time) {
+	self.mx.Lock()
+	self.ts = ts
+	self.mx.Unlock()
+}
@@ -0,0 +1,63 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"math"
+	"net/http"
+	"time"
+)
+
+// adaptive pending limit per page.
+// every interval: gradient = rtt/med in [0.5, 1], where med is median of passed requests
+// and rtt is long term minimum of passed requests drifting towards current minimum with smoothing/10,
+// limit = limit*(1-smoothing) + (limit*gradient + sqrt(limit))*smoothing.
+// limit grows while latency median stays near minimum and shrinks when requests queue up.
+type Gradient_t[Key_t comparable] struct {
+	initial     int64
+	min_limit   int64
+	max_limit   int64
+	min_samples int
+	smoothing   float64
+	interval    time.Duration
+}
+
+func NewGradient[Key_t comparable](initial int64, min_limit int64, max_limit int64, min_samples int, smoothing float64, interval time.Duration) *Gradient_t[Key_t] {
+	return &Gradient_t[Key_t]{
+		initial:     initial,
+		min_limit:   min_limit,
+		max_limit:   max_limit,
+		min_samples: min_samples,
+		smoothing:   smoothing,
+		interval:    interval,
+	}
+}
+
+func (self *Gradient_t[Key_t]) PendingLimit(r *http.Request, page Key_t, counter *Counter_t, ts time.Time) int64 {
+	counter.mx.Lock()
+	defer counter.mx.Unlock()
+	if counter.limit == 0 {
+		counter.limit = float64(self.initial)
+		counter.limit_ts = ts
+	}
+	if ts.Sub(counter.limit_ts) >= self.interval {
+		counter.limit_ts = ts
+		if counter.passed == nil {
+			return int64(counter.limit)
+		}
+		if med, _, _, size := counter.passed.Value(ts); size >= self.min_samples && med > 0 {
+			if rtt := float64(counter.passed.Min()); counter.limit_rtt == 0 || rtt < counter.limit_rtt {
+				counter.limit_rtt = rtt
+			} else {
+				counter.limit_rtt += (rtt - counter.limit_rtt) * self.smoothing / 10
+			}
+			gradient := math.Max(0.5, math.Min(1.0, counter.limit_rtt/float64(med)))
+			next := counter.limit*gradient + math.Sqrt(counter.limit)
+			next = counter.limit*(1-self.smoothing) + next*self.smoothing
+			counter.limit = math.Min(math.Max(next, float64(self.min_limit)), float64(self.max_limit))
+		}
+	}
+	return int64(counter.limit)
+}
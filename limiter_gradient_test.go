@@ -0,0 +1,104 @@
+//
+// go test -run Test_Gradient -v -count=1
+//
+
+package ministat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Gradient01(t *testing.T) {
+	s := NewStorage(10, 100, 10*time.Second, NoEvict[string])
+	g := NewGradient[string](20, 5, 100, 10, 0.2, time.Second)
+
+	ts := time.Now()
+	hit := func(latency time.Duration) *Counter_t {
+		counter, _, _, _ := s.HitBegin("page", ts)
+		s.HitEnd(counter, ts, ts.Add(latency), nil)
+		counter.passed_end(ts.Add(latency), latency)
+		return counter
+	}
+
+	// stable latency, limit grows
+	var counter *Counter_t
+	for i := 0; i < 20; i++ {
+		counter = hit(10 * time.Millisecond)
+	}
+	prev := g.PendingLimit(nil, "page", counter, ts)
+	assert.Assert(t, prev == 20, prev)
+	for i := 0; i < 10; i++ {
+		ts = ts.Add(time.Second)
+		hit(10 * time.Millisecond)
+		limit := g.PendingLimit(nil, "page", counter, ts)
+		assert.Assert(t, limit >= prev, "%v %v", limit, prev)
+		prev = limit
+	}
+	assert.Assert(t, prev > 20, prev)
+
+	// latency grows, limit shrinks
+	high := prev
+	for i := 0; i < 30; i++ {
+		ts = ts.Add(time.Second)
+		hit(time.Second)
+		prev = g.PendingLimit(nil, "page", counter, ts)
+	}
+	assert.Assert(t, prev < high/2, "%v %v", prev, high)
+
+	res, _ := s.HitStat(ts, "page")
+	assert.Assert(t, res.Limit == prev, res.Limit)
+
+	// slow latency becomes normal, limit grows again
+	low := prev
+	for i := 0; i < 300; i++ {
+		ts = ts.Add(time.Second)
+		hit(time.Second)
+		prev = g.PendingLimit(nil, "page", counter, ts)
+	}
+	assert.Assert(t, prev > low, "%v %v", prev, low)
+	assert.Assert(t, res.GaugeCurrent()[8].GetName() == "limit", res.GaugeCurrent())
+}
+
+// rejected requests do not lower latency seen by limiter
+func Test_Gradient02(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewStorage(10, 100, 10*time.Second, NoEvict[Page_t])
+	s.SetClock(clock)
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Add(100 * time.Millisecond)
+	})
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	m := NewMiddleware[Page_t](s, passed, failed, nil, GetPageName, 10, nil)
+	m.SetClock(clock)
+	m.SetLimiter(NewGradient[Page_t](100, 5, 200, 5, 0.2, time.Second))
+	// level 0 is always shed
+	m.SetPriority(GetPriorityHeader("X-Priority"), map[string]float64{"reject": 0}, 1)
+
+	serve := func(priority string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/page", nil)
+		r.Header.Set("X-Priority", priority)
+		m.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < 60; i++ {
+		for j := 0; j < 9; j++ {
+			assert.Assert(t, serve("") == http.StatusOK)
+		}
+		assert.Assert(t, serve("reject") == http.StatusServiceUnavailable)
+		clock.Add(100 * time.Millisecond)
+	}
+
+	res, _ := s.HitStat(s.Now(), Page_t{Name: "/page"})
+	assert.Assert(t, res.Limit >= 100, res.Limit)
+	v, _ := res.Value("tag", REJECT, REJECT_PRIORITY)
+	assert.Assert(t, v == 60, v)
+}
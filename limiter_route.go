@@ -0,0 +1,36 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ondi/go-tst"
+)
+
+// pending limit by longest prefix of r.URL.Path, default if no route matches
+type RouteLimit_t[Key_t comparable] struct {
+	routes        *tst.Tree3_t[int64]
+	pending_limit int64
+}
+
+func NewRouteLimit[Key_t comparable](pending_limit int64, routes map[string]int64) (self *RouteLimit_t[Key_t]) {
+	self = &RouteLimit_t[Key_t]{
+		routes:        tst.NewTree3[int64](),
+		pending_limit: pending_limit,
+	}
+	for k, v := range routes {
+		self.routes.Add(k, v)
+	}
+	return
+}
+
+func (self *RouteLimit_t[Key_t]) PendingLimit(r *http.Request, page Key_t, counter *Counter_t, ts time.Time) int64 {
+	if value, _, found := self.routes.Search(r.URL.Path); found > 0 {
+		return value
+	}
+	return self.pending_limit
+}
@@ -0,0 +1,49 @@
+//
+// go test -run Test_RouteLimit -v -count=1
+//
+
+package ministat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_RouteLimit01(t *testing.T) {
+	l := NewRouteLimit[Page_t](10, map[string]int64{"/export": 2, "/search": 200, "/search/slow": 1})
+
+	for path, limit := range map[string]int64{
+		"/export":         2,
+		"/export/csv":     2,
+		"/search?q=1":     200,
+		"/search/fast":    200,
+		"/search/slow/v1": 1,
+		"/other":          10,
+		"/":               10,
+	} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		res := l.PendingLimit(r, GetPageName(r), nil, time.Now())
+		assert.Assert(t, res == limit, "%v %v", path, res)
+	}
+}
+
+func Test_RouteLimit02(t *testing.T) {
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	m := NewMiddleware[Page_t](s, http.NotFoundHandler(), failed, nil, GetPageName, 10, nil)
+	m.SetLimiter(NewRouteLimit[Page_t](10, map[string]int64{"/export": 0}))
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	assert.Assert(t, w.Code == http.StatusServiceUnavailable, w.Code)
+
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search", nil))
+	assert.Assert(t, w.Code == http.StatusNotFound, w.Code)
+}
@@ -10,6 +10,8 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/ondi/go-tst"
 )
 
 type Gauge interface {
@@ -25,22 +27,44 @@ type Views[Key_t comparable] interface {
 	HitCurrent(page Key_t, g []Gauge) (err error)
 }
 
+// implemented by Storage_t and Sharded_t
+type Storage[Key_t comparable] interface {
+	HitBegin(name Key_t, begin time.Time) (counter *Counter_t, sampling int64, pending int64, rpm int64)
+	HitEnd(counter *Counter_t, begin time.Time, end time.Time, tags map[string]map[string]int64)
+}
+
+// pending limit of page, replaces constant pending_limit of Middleware_t
+type Limiter[Key_t comparable] interface {
+	PendingLimit(r *http.Request, page Key_t, counter *Counter_t, ts time.Time) int64
+}
+
 type GetPage_t[Key_t comparable] func(*http.Request) Key_t
 type TagsCount_t func(ctx context.Context, out map[string]map[string]int64)
 type TagsAll_t func(ctx context.Context, out map[string]map[string]string)
 
 type Middleware_t[Key_t comparable] struct {
-	storage       *Storage_t[Key_t]
+	storage       Storage[Key_t]
 	next_passed   http.Handler
 	next_failed   http.Handler
 	get_page      GetPage_t[Key_t]
 	views         Views[Key_t]
 	pending_limit int64
 	tags          TagsCount_t
+	clock         Clock
+	limiter       Limiter[Key_t]
+	queue_depth   int64
+	queue_wait    time.Duration
+	rate          Rate_t
+	rate_routes   *tst.Tree3_t[Rate_t]
+	client        *client_limit_t
+	fair          *Fair_t[Key_t]
+	priority      *priority_t
+	codel         *codel_t
+	sampling      *Sampling_t[Key_t]
 }
 
 func NewMiddleware[Key_t comparable](
-	storage *Storage_t[Key_t],
+	storage Storage[Key_t],
 	next_passed http.Handler,
 	next_failed http.Handler,
 	views Views[Key_t],
@@ -56,14 +80,43 @@ func NewMiddleware[Key_t comparable](
 		views:         views,
 		pending_limit: pending_limit,
 		tags:          tags,
+		clock:         SystemClock_t{},
 	}
 }
 
+// has to be called before ServeHTTP
+func (self *Middleware_t[Key_t]) SetClock(clock Clock) {
+	self.clock = clock
+}
+
+// has to be called before ServeHTTP
+func (self *Middleware_t[Key_t]) SetLimiter(limiter Limiter[Key_t]) {
+	self.limiter = limiter
+}
+
+func (self *Middleware_t[Key_t]) pending_limit_get(r *http.Request, page Key_t, counter *Counter_t, ts time.Time) int64 {
+	if self.limiter != nil {
+		return self.limiter.PendingLimit(r, page, counter, ts)
+	}
+	return self.pending_limit
+}
+
 func (self *Middleware_t[Key_t]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ts := time.Now()
+	ts := self.clock.Now()
 	page := self.get_page(r)
 	writer := ResponseWriter_t{ResponseWriter: w, status_code: http.StatusOK}
 	counter, sampling, pending, _ := self.storage.HitBegin(page, ts)
+	if self.sampling != nil {
+		if value, ok := self.sampling.sample(r, page); ok {
+			sampling = value
+		}
+	}
+	var passed bool
+	var reject, priority string
+	var client_counter *Counter_t
+	if self.client != nil {
+		client_counter, reject = self.client.begin(r, ts)
+	}
 	defer func() {
 		tags := map[string]map[string]int64{}
 		if self.tags != nil {
@@ -73,15 +126,80 @@ func (self *Middleware_t[Key_t]) ServeHTTP(w http.ResponseWriter, r *http.Reques
 			tags["CODE"] = map[string]int64{}
 		}
 		tags["CODE"][strconv.FormatInt(int64(writer.status_code), 10)] = 1
-		self.storage.HitEnd(counter, ts, time.Now(), tags)
+		if len(reject) > 0 {
+			tag_add(tags, REJECT, reject)
+		}
+		if len(priority) > 0 {
+			if passed {
+				tag_add(tags, PRIORITY_ADMITTED, priority)
+			} else {
+				tag_add(tags, PRIORITY_SHED, priority)
+			}
+		}
+		end := self.clock.Now()
+		if passed && self.limiter != nil {
+			counter.passed_end(end, end.Sub(ts))
+		}
+		if passed && self.codel != nil {
+			counter.codel_end(end, end.Sub(ts), self.codel)
+		}
+		self.storage.HitEnd(counter, ts, end, tags)
+		if client_counter != nil {
+			self.client.storage.HitEnd(client_counter, ts, end, tags)
+		}
 	}()
-	if sampling > 0 && pending <= self.pending_limit {
+	var limit int64
+	if len(reject) == 0 && sampling <= 0 {
+		reject = REJECT_SAMPLING
+	}
+	if len(reject) == 0 {
+		limit = self.pending_limit_get(r, page, counter, ts)
+		if self.priority != nil {
+			priority, reject = self.priority.begin(r, pending, limit)
+		}
+		passed = len(reject) == 0 && pending <= limit
+		if passed == false && len(reject) == 0 {
+			if self.queue_depth > 0 {
+				passed = self.wait(r, page, counter)
+			}
+			if passed == false {
+				reject = REJECT_CONCURRENCY
+			}
+		}
+	}
+	if passed && self.codel != nil {
+		if passed = counter.codel_begin(ts, self.codel); passed == false {
+			reject = REJECT_LATENCY
+		}
+	}
+	if passed {
+		if rate := self.rate_get(r); rate.Rate > 0 && counter.rate_take(ts, rate) == false {
+			passed = false
+			reject = REJECT_RATELIMIT
+		}
+	}
+	if passed && self.fair != nil {
+		if passed = self.fair.Enter(page); passed {
+			defer self.fair.Leave(page)
+		} else {
+			reject = REJECT_FAIRSHARE
+		}
+	}
+	if passed {
 		self.next_passed.ServeHTTP(&writer, r)
 	} else {
+		r = r.WithContext(WithReject(r.Context(), Reject_t{Reason: reject, Pending: pending, Limit: limit, Latency: counter.median_value()}))
 		self.next_failed.ServeHTTP(&writer, r)
 	}
 }
 
+func tag_add(tags map[string]map[string]int64, level string, key string) {
+	if tags[level] == nil {
+		tags[level] = map[string]int64{}
+	}
+	tags[level][key]++
+}
+
 type StatusBodyError_t struct {
 	Code      int    `json:"code,omitzero"`
 	ErrorCode int    `json:"errorCode,omitzero"`
@@ -0,0 +1,69 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// empty key is not limited
+type GetClient_t func(*http.Request) string
+
+func GetClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func GetClientHeader(name string) GetClient_t {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+func GetClientContext(key any) GetClient_t {
+	return func(r *http.Request) string {
+		res, _ := r.Context().Value(key).(string)
+		return res
+	}
+}
+
+type client_limit_t struct {
+	storage       Storage[string]
+	get_client    GetClient_t
+	pending_limit int64
+	rate          Rate_t
+}
+
+// clients are counted in own storage, bounded storage evicts least active clients.
+// requests of client over pending_limit or rate are passed to next_failed
+// and counted as REJECT/CLIENT_CONCURRENCY or REJECT/CLIENT_RATELIMIT tag. 0 = no limit.
+// has to be called before ServeHTTP
+func (self *Middleware_t[Key_t]) SetClientLimit(storage Storage[string], get_client GetClient_t, pending_limit int64, rate Rate_t) {
+	self.client = &client_limit_t{
+		storage:       storage,
+		get_client:    get_client,
+		pending_limit: pending_limit,
+		rate:          rate,
+	}
+}
+
+// counter is nil if client is not limited
+func (self *client_limit_t) begin(r *http.Request, ts time.Time) (counter *Counter_t, reject string) {
+	client := self.get_client(r)
+	if len(client) == 0 {
+		return
+	}
+	counter, _, pending, _ := self.storage.HitBegin(client, ts)
+	if self.pending_limit > 0 && pending > self.pending_limit {
+		reject = REJECT_CLIENT_CONCURRENCY
+	} else if self.rate.Rate > 0 && counter.rate_take(ts, self.rate) == false {
+		reject = REJECT_CLIENT_RATELIMIT
+	}
+	return
+}
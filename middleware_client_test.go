@@ -0,0 +1,76 @@
+//
+// go test -run Test_Client -v -count=1
+//
+
+package ministat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Client01(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	clients := NewStorage(100, 10, 10*time.Second, NoEvict[string])
+	var m *Middleware_t[Page_t]
+	var nested []int
+	serve := func(client string, path string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("X-Api-Key", client)
+		m.ServeHTTP(w, r)
+		return w.Code
+	}
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// second request of same client and of other client while first is pending
+		if r.URL.Path == "/nested" {
+			nested = append(nested, serve(r.Header.Get("X-Api-Key"), "/page"), serve("b", "/page"))
+		}
+	})
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	m = NewMiddleware[Page_t](s, passed, failed, nil, GetPageName, 10, nil)
+	m.SetClock(clock)
+	m.SetClientLimit(clients, GetClientHeader("X-Api-Key"), 1, Rate_t{Rate: 1, Burst: 2})
+
+	assert.Assert(t, serve("a", "/nested") == http.StatusOK)
+	assert.DeepEqual(t, nested, []int{http.StatusTooManyRequests, http.StatusOK})
+
+	// rate, a has one token left
+	assert.Assert(t, serve("a", "/page") == http.StatusOK)
+	assert.Assert(t, serve("a", "/page") == http.StatusTooManyRequests)
+	assert.Assert(t, serve("b", "/page") == http.StatusOK)
+
+	// no key is not limited
+	for i := 0; i < 5; i++ {
+		assert.Assert(t, serve("", "/page") == http.StatusOK)
+	}
+
+	res, _ := clients.HitStat(clock.Now(), "a")
+	assert.Assert(t, res.Hits == 4, res.Hits)
+	v, _ := res.Value("tag", REJECT, "CLIENT_CONCURRENCY")
+	assert.Assert(t, v == 1, v)
+	v, _ = res.Value("tag", REJECT, "CLIENT_RATELIMIT")
+	assert.Assert(t, v == 1, v)
+
+	res, _ = clients.HitStat(clock.Now(), "b")
+	assert.Assert(t, res.Hits == 2 && len(res.Tags) == 1, res)
+
+	res, _ = s.HitStat(clock.Now(), Page_t{Name: "/page"})
+	v, _ = res.Value("tag", REJECT, "CLIENT_RATELIMIT")
+	assert.Assert(t, v == 1, v)
+}
+
+func Test_Client02(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/page", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	assert.Assert(t, GetClientIP(r) == "10.0.0.1")
+	r.RemoteAddr = "10.0.0.1"
+	assert.Assert(t, GetClientIP(r) == "10.0.0.1")
+}
@@ -0,0 +1,52 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"time"
+)
+
+type codel_t struct {
+	target   time.Duration
+	interval time.Duration
+}
+
+// latency of passed requests including queue wait is kept in window of interval,
+// when minimum of window stays above target for interval new requests of page
+// are passed to next_failed and counted as REJECT/LATENCY tag.
+// shedding stops when minimum falls below target or window expires. 0 = disabled.
+// has to be called before ServeHTTP
+func (self *Middleware_t[Key_t]) SetCodel(target time.Duration, interval time.Duration) {
+	if target > 0 && interval > 0 {
+		self.codel = &codel_t{target: target, interval: interval}
+	} else {
+		self.codel = nil
+	}
+}
+
+func (self *Counter_t) codel_begin(ts time.Time, codel *codel_t) bool {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	if self.codel == nil {
+		return true
+	}
+	if self.codel.Evict(ts); self.codel.Size() == 0 || self.codel.Min() < codel.target {
+		self.codel_above = time.Time{}
+		return true
+	}
+	if self.codel_above.IsZero() {
+		self.codel_above = ts
+	}
+	return ts.Sub(self.codel_above) < codel.interval
+}
+
+func (self *Counter_t) codel_end(ts time.Time, latency time.Duration, codel *codel_t) {
+	self.mx.Lock()
+	if self.codel == nil {
+		self.codel = NewMedian[time.Duration](self.median.limit, codel.interval)
+	}
+	self.codel.Add(ts, latency)
+	self.mx.Unlock()
+}
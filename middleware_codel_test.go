@@ -0,0 +1,56 @@
+//
+// go test -run Test_Codel -v -count=1
+//
+
+package ministat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Codel01(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	s.SetClock(clock)
+	delay := 100 * time.Millisecond
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Add(delay)
+	})
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	m := NewMiddleware[Page_t](s, passed, failed, nil, GetPageName, 10, nil)
+	m.SetClock(clock)
+	m.SetCodel(50*time.Millisecond, time.Second)
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+		clock.Add(300 * time.Millisecond)
+		return w.Code
+	}
+
+	// above target since 0.4s, shedding at 1.6s
+	var codes []int
+	for i := 0; i < 6; i++ {
+		codes = append(codes, serve())
+	}
+	assert.DeepEqual(t, codes, []int{200, 200, 200, 200, 503, 503})
+
+	// window expires at 2.3s
+	delay = 10 * time.Millisecond
+	codes = nil
+	for i := 0; i < 6; i++ {
+		codes = append(codes, serve())
+	}
+	assert.DeepEqual(t, codes, []int{503, 200, 200, 200, 200, 200})
+
+	res, _ := s.HitStat(s.Now(), Page_t{Name: "/page"})
+	v, _ := res.Value("tag", REJECT, "LATENCY")
+	assert.Assert(t, v == 3, v)
+}
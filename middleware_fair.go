@@ -0,0 +1,96 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"sync"
+)
+
+// weighted fair share of concurrency between classes of pages, for example PageEntry.
+// while total pending is below capacity every request is admitted,
+// above capacity request is admitted only if pending of its class is below share:
+// share = capacity * weight / sum of weights of classes with pending requests.
+// slots borrowed by a class over share are returned when its requests finish,
+// so capacity is exceeded only by classes claiming their share.
+type Fair_t[Key_t comparable] struct {
+	mx             sync.Mutex
+	class          PageClass_t[Key_t]
+	capacity       int64
+	weights        map[string]float64
+	weight_default float64
+	pending        map[string]int64
+	total          int64
+}
+
+// weight_default is used for classes not in weights
+func NewFair[Key_t comparable](class PageClass_t[Key_t], capacity int64, weights map[string]float64, weight_default float64) *Fair_t[Key_t] {
+	return &Fair_t[Key_t]{
+		class:          class,
+		capacity:       capacity,
+		weights:        weights,
+		weight_default: weight_default,
+		pending:        map[string]int64{},
+	}
+}
+
+func (self *Fair_t[Key_t]) weight(class string) float64 {
+	if res, ok := self.weights[class]; ok {
+		return res
+	}
+	return self.weight_default
+}
+
+// share of class, class is counted as active
+func (self *Fair_t[Key_t]) share(class string) float64 {
+	sum := self.weight(class)
+	for k := range self.pending {
+		if k != class {
+			sum += self.weight(k)
+		}
+	}
+	if sum <= 0 {
+		return 0
+	}
+	return float64(self.capacity) * self.weight(class) / sum
+}
+
+// Leave has to be called for admitted page
+func (self *Fair_t[Key_t]) Enter(page Key_t) (ok bool) {
+	class := self.class(page)
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	if ok = self.total < self.capacity || float64(self.pending[class]) < self.share(class); ok {
+		self.pending[class]++
+		self.total++
+	}
+	return
+}
+
+func (self *Fair_t[Key_t]) Leave(page Key_t) {
+	class := self.class(page)
+	self.mx.Lock()
+	if self.pending[class]--; self.pending[class] <= 0 {
+		delete(self.pending, class)
+	}
+	self.total--
+	self.mx.Unlock()
+}
+
+// pending requests by class
+func (self *Fair_t[Key_t]) Pending() (out map[string]int64) {
+	out = map[string]int64{}
+	self.mx.Lock()
+	for k, v := range self.pending {
+		out[k] = v
+	}
+	self.mx.Unlock()
+	return
+}
+
+// requests over fair share are passed to next_failed and counted as REJECT/FAIRSHARE tag.
+// has to be called before ServeHTTP
+func (self *Middleware_t[Key_t]) SetFair(fair *Fair_t[Key_t]) {
+	self.fair = fair
+}
@@ -0,0 +1,76 @@
+//
+// go test -run Test_Fair -v -count=1
+//
+
+package ministat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Fair01(t *testing.T) {
+	f := NewFair(PageEntry, 4, map[string]float64{"a": 3}, 1)
+	a, b, c := Page_t{Entry: "a"}, Page_t{Entry: "b"}, Page_t{Entry: "c"}
+
+	// no contention, a takes all capacity
+	for i := 0; i < 4; i++ {
+		assert.Assert(t, f.Enter(a))
+	}
+	assert.Assert(t, f.Enter(a) == false)
+
+	// b claims share 4*1/4
+	assert.Assert(t, f.Enter(b))
+	assert.Assert(t, f.Enter(b) == false)
+
+	// a share is 3 now
+	f.Leave(a)
+	assert.Assert(t, f.Enter(a) == false)
+
+	// c share 4*1/5
+	assert.Assert(t, f.Enter(c))
+	assert.Assert(t, f.Enter(c) == false)
+	assert.DeepEqual(t, f.Pending(), map[string]int64{"a": 3, "b": 1, "c": 1})
+
+	for i := 0; i < 3; i++ {
+		f.Leave(a)
+	}
+	f.Leave(b)
+	f.Leave(c)
+	assert.DeepEqual(t, f.Pending(), map[string]int64{})
+}
+
+func Test_Fair02(t *testing.T) {
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	var m *Middleware_t[Page_t]
+	var nested []int
+	serve := func(entry string, path string) int {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+entry+path, nil))
+		return w.Code
+	}
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nested" {
+			nested = append(nested, serve(r.Host, "/page"), serve("b", "/page"))
+		}
+	})
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	get_page := func(r *http.Request) Page_t {
+		return Page_t{Entry: r.Host, Name: r.URL.Path}
+	}
+	m = NewMiddleware[Page_t](s, passed, failed, nil, get_page, 10, nil)
+	m.SetFair(NewFair(PageEntry, 1, nil, 1))
+
+	assert.Assert(t, serve("a", "/nested") == http.StatusOK)
+	assert.DeepEqual(t, nested, []int{http.StatusServiceUnavailable, http.StatusOK})
+
+	res, _ := s.HitStat(time.Now(), Page_t{Entry: "a", Name: "/page"})
+	v, _ := res.Value("tag", REJECT, "FAIRSHARE")
+	assert.Assert(t, v == 1, v)
+}
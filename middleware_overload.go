@@ -0,0 +1,87 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// tag level of rejected requests, keys are reasons
+const REJECT = "REJECT"
+
+const (
+	REJECT_SAMPLING           = "SAMPLING"
+	REJECT_CONCURRENCY        = "CONCURRENCY"
+	REJECT_RATELIMIT          = "RATELIMIT"
+	REJECT_CLIENT_CONCURRENCY = "CLIENT_CONCURRENCY"
+	REJECT_CLIENT_RATELIMIT   = "CLIENT_RATELIMIT"
+	REJECT_FAIRSHARE          = "FAIRSHARE"
+	REJECT_PRIORITY           = "PRIORITY"
+	REJECT_LATENCY            = "LATENCY"
+)
+
+// passed to next_failed in request context
+type Reject_t struct {
+	Reason  string
+	Pending int64
+	Limit   int64         // pending limit, 0 if not checked
+	Latency time.Duration // median of page
+}
+
+type reject_key_t struct{}
+
+func WithReject(ctx context.Context, reject Reject_t) context.Context {
+	return context.WithValue(ctx, reject_key_t{}, reject)
+}
+
+func GetReject(ctx context.Context) (res Reject_t, ok bool) {
+	res, ok = ctx.Value(reject_key_t{}).(Reject_t)
+	return
+}
+
+// time for pending over limit to drain at median latency
+func (self Reject_t) RetryAfter() time.Duration {
+	if self.Limit > 0 && self.Pending > self.Limit {
+		return self.Latency * time.Duration(self.Pending-self.Limit) / time.Duration(self.Limit)
+	}
+	return self.Latency
+}
+
+// rejections of client are 429, others are 503
+func (self Reject_t) StatusCode() int {
+	switch self.Reason {
+	case REJECT_RATELIMIT, REJECT_CLIENT_RATELIMIT, REJECT_CLIENT_CONCURRENCY:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+// next_failed for Middleware_t, writes StatusBody_t with reason in Message
+// and Retry-After in seconds clamped to [min_retry, max_retry]
+type Overload_t struct {
+	min_retry time.Duration
+	max_retry time.Duration
+}
+
+func NewOverload(min_retry time.Duration, max_retry time.Duration) *Overload_t {
+	return &Overload_t{
+		min_retry: min_retry,
+		max_retry: max_retry,
+	}
+}
+
+func (self *Overload_t) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reject, ok := GetReject(r.Context())
+	if ok == false {
+		reject.Reason = REJECT_CONCURRENCY
+	}
+	retry := min(max(reject.RetryAfter(), self.min_retry), self.max_retry)
+	w.Header().Set("Retry-After", strconv.FormatInt(int64((retry+time.Second-1)/time.Second), 10))
+	StatusBody_t{Error: StatusBodyError_t{Code: reject.StatusCode(), Message: reject.Reason}}.ServeHTTP(w, r)
+}
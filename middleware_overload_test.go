@@ -0,0 +1,67 @@
+//
+// go test -run Test_Overload -v -count=1
+//
+
+package ministat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Overload01(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	s.SetClock(clock)
+	var m *Middleware_t[Page_t]
+	var nested *httptest.ResponseRecorder
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("nested") != "" {
+			nested = httptest.NewRecorder()
+			m.ServeHTTP(nested, httptest.NewRequest(http.MethodGet, "/page", nil))
+		}
+		clock.Add(3 * time.Second)
+	})
+	m = NewMiddleware[Page_t](s, passed, NewOverload(time.Second, time.Minute), nil, GetPageName, 1, nil)
+	m.SetClock(clock)
+
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/page", nil))
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/page?nested=1", nil))
+
+	assert.Assert(t, nested.Code == http.StatusServiceUnavailable, nested.Code)
+	assert.Assert(t, nested.Header().Get("Retry-After") == "3", nested.Header())
+	var body StatusBody_t
+	assert.NilError(t, json.Unmarshal(nested.Body.Bytes(), &body))
+	assert.Assert(t, body.Error.Code == http.StatusServiceUnavailable, body)
+	assert.Assert(t, body.Error.Message == REJECT_CONCURRENCY, body)
+
+	res, _ := s.HitStat(s.Now(), Page_t{Name: "/page"})
+	v, _ := res.Value("tag", REJECT, REJECT_CONCURRENCY)
+	assert.Assert(t, v == 1, v)
+}
+
+func Test_Overload02(t *testing.T) {
+	o := NewOverload(time.Second, 10*time.Second)
+	for _, v := range []struct {
+		reject Reject_t
+		code   int
+		retry  string
+	}{
+		{Reject_t{Reason: REJECT_RATELIMIT}, http.StatusTooManyRequests, "1"},
+		{Reject_t{Reason: REJECT_CLIENT_CONCURRENCY}, http.StatusTooManyRequests, "1"},
+		{Reject_t{Reason: REJECT_SAMPLING, Latency: 1500 * time.Millisecond}, http.StatusServiceUnavailable, "2"},
+		{Reject_t{Reason: REJECT_CONCURRENCY, Pending: 30, Limit: 10, Latency: time.Second}, http.StatusServiceUnavailable, "2"},
+		{Reject_t{Reason: REJECT_LATENCY, Pending: 1000, Limit: 10, Latency: time.Second}, http.StatusServiceUnavailable, "10"},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/page", nil)
+		o.ServeHTTP(w, r.WithContext(WithReject(r.Context(), v.reject)))
+		assert.Assert(t, w.Code == v.code, v)
+		assert.Assert(t, w.Header().Get("Retry-After") == v.retry, "%v %v", v, w.Header())
+	}
+}
@@ -0,0 +1,73 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"net/http"
+)
+
+const (
+	PRIORITY_CRITICAL  = "critical"
+	PRIORITY_DEFAULT   = "default"
+	PRIORITY_SHEDDABLE = "sheddable"
+)
+
+// tag levels of admitted and shed requests by priority
+const (
+	PRIORITY_ADMITTED = "PRIORITY_ADMITTED"
+	PRIORITY_SHED     = "PRIORITY_SHED"
+)
+
+// empty priority is PRIORITY_DEFAULT
+type GetPriority_t func(*http.Request) string
+
+func GetPriorityHeader(name string) GetPriority_t {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// example
+func PriorityLevels() map[string]float64 {
+	return map[string]float64{
+		PRIORITY_CRITICAL:  1,
+		PRIORITY_DEFAULT:   0.8,
+		PRIORITY_SHEDDABLE: 0.5,
+	}
+}
+
+type priority_t struct {
+	get_priority  GetPriority_t
+	levels        map[string]float64
+	level_default float64
+}
+
+// request is shed when pending of page is over pending limit * level of its priority,
+// so lower priorities are shed first as pending approaches the limit.
+// requests with level 1 and over are limited by pending limit and queue only.
+// unknown priorities use level_default and are counted as PRIORITY_DEFAULT.
+// has to be called before ServeHTTP
+func (self *Middleware_t[Key_t]) SetPriority(get_priority GetPriority_t, levels map[string]float64, level_default float64) {
+	self.priority = &priority_t{
+		get_priority:  get_priority,
+		levels:        levels,
+		level_default: level_default,
+	}
+}
+
+func (self *priority_t) begin(r *http.Request, pending int64, limit int64) (priority string, reject string) {
+	if priority = self.get_priority(r); len(priority) == 0 {
+		priority = PRIORITY_DEFAULT
+	}
+	level, ok := self.levels[priority]
+	if ok == false {
+		// priority comes from client, tags are not created for every value
+		level, priority = self.level_default, PRIORITY_DEFAULT
+	}
+	if level < 1 && float64(pending) > float64(limit)*level {
+		reject = REJECT_PRIORITY
+	}
+	return
+}
@@ -0,0 +1,64 @@
+//
+// go test -run Test_Priority -v -count=1
+//
+
+package ministat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Priority01(t *testing.T) {
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	var m *Middleware_t[Page_t]
+	var nested []int
+	serve := func(priority string, path string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("X-Priority", priority)
+		m.ServeHTTP(w, r)
+		return w.Code
+	}
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// pending is 2 in nested requests
+		if r.URL.Path == "/nested" {
+			nested = append(nested, serve(PRIORITY_SHEDDABLE, "/nested/1"), serve("", "/nested/2"), serve(PRIORITY_CRITICAL, "/nested/3"))
+		}
+	})
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	get_page := func(r *http.Request) Page_t {
+		return Page_t{Name: "/nested"}
+	}
+	m = NewMiddleware[Page_t](s, passed, failed, nil, get_page, 2, nil)
+	m.SetPriority(GetPriorityHeader("X-Priority"), PriorityLevels(), 0.5)
+
+	assert.Assert(t, serve(PRIORITY_CRITICAL, "/nested") == http.StatusOK)
+	assert.DeepEqual(t, nested, []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK})
+
+	// pending is 1, unknown priorities do not add tags
+	for i := 0; i < 100; i++ {
+		assert.Assert(t, serve("unknown-"+strconv.Itoa(i), "/page") == http.StatusOK)
+	}
+
+	res, _ := s.HitStat(time.Now(), Page_t{Name: "/nested"})
+	for _, v := range []TagValue_t{
+		{Level: PRIORITY_ADMITTED, Key: PRIORITY_CRITICAL, Value: 2},
+		{Level: PRIORITY_ADMITTED, Key: PRIORITY_DEFAULT, Value: 100},
+		{Level: PRIORITY_SHED, Key: PRIORITY_SHEDDABLE, Value: 1},
+		{Level: PRIORITY_SHED, Key: PRIORITY_DEFAULT, Value: 1},
+		{Level: REJECT, Key: REJECT_PRIORITY, Value: 2},
+	} {
+		value, ok := res.Value("tag", v.Level, v.Key)
+		assert.Assert(t, ok && value == float64(v.Value), v)
+	}
+	// and CODE 200, 503
+	assert.Assert(t, len(res.Tags) == 7, res.Tags)
+}
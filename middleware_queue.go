@@ -0,0 +1,55 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"net/http"
+	"time"
+)
+
+// requests over pending limit wait up to wait and not longer than request context,
+// no more than depth requests of page wait at once. 0 = no queue.
+// has to be called before ServeHTTP
+func (self *Middleware_t[Key_t]) SetQueue(depth int64, wait time.Duration) {
+	self.queue_depth = depth
+	self.queue_wait = wait
+}
+
+// waiting request is counted in pending and queue, so pending-queue is number of running requests
+func (self *Middleware_t[Key_t]) wait(r *http.Request, page Key_t, counter *Counter_t) bool {
+	if counter.queue.Add(1) > self.queue_depth {
+		counter.queue.Add(-1)
+		return false
+	}
+	begin := self.clock.Now()
+	timer := time.NewTimer(self.queue_wait)
+	defer timer.Stop()
+	for {
+		if counter.pending.Load()-counter.queue.Load() < self.pending_limit_get(r, page, counter, self.clock.Now()) {
+			return self.wait_end(counter, begin, true)
+		}
+		select {
+		case <-counter.wake:
+		case <-timer.C:
+			return self.wait_end(counter, begin, false)
+		case <-r.Context().Done():
+			return self.wait_end(counter, begin, false)
+		}
+	}
+}
+
+func (self *Middleware_t[Key_t]) wait_end(counter *Counter_t, begin time.Time, ok bool) bool {
+	counter.queue.Add(-1)
+	end := self.clock.Now()
+	counter.mx.Lock()
+	if counter.queue_wait == nil {
+		counter.queue_wait = NewMedian[time.Duration](counter.median.limit, counter.median.ttl)
+	}
+	counter.queue_wait.Add(end, end.Sub(begin))
+	counter.mx.Unlock()
+	// pass wake up to next waiting request
+	counter.wake_up()
+	return ok
+}
@@ -0,0 +1,96 @@
+//
+// go test -run Test_Queue -v -count=1
+//
+
+package ministat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+type queue_test_t struct {
+	storage *Storage_t[Page_t]
+	m       *Middleware_t[Page_t]
+	release chan struct{}
+	wg      sync.WaitGroup
+	codes   []int
+}
+
+// pending limit 1, first request runs until release, others wait in queue
+func new_queue_test(depth int64, requests int) (self *queue_test_t) {
+	self = &queue_test_t{
+		storage: NewStorage(100, 10, 10*time.Second, NoEvict[Page_t]),
+		release: make(chan struct{}),
+		codes:   make([]int, requests),
+	}
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-self.release
+	})
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	self.m = NewMiddleware[Page_t](self.storage, passed, failed, nil, GetPageName, 1, nil)
+	self.m.SetQueue(depth, time.Minute)
+	for i := range self.codes {
+		self.wg.Add(1)
+		go func() {
+			defer self.wg.Done()
+			self.codes[i] = self.serve(context.Background())
+		}()
+	}
+	for {
+		if res, _ := self.storage.HitStat(time.Now(), Page_t{Name: "/page"}); res.Queue == int64(requests-1) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (self *queue_test_t) serve(ctx context.Context) int {
+	w := httptest.NewRecorder()
+	self.m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil).WithContext(ctx))
+	return w.Code
+}
+
+func (self *queue_test_t) done() (res Stat_t) {
+	close(self.release)
+	self.wg.Wait()
+	res, _ = self.storage.HitStat(time.Now(), Page_t{Name: "/page"})
+	return
+}
+
+func Test_Queue01(t *testing.T) {
+	q := new_queue_test(2, 3)
+
+	// queue is full
+	code := q.serve(context.Background())
+	assert.Assert(t, code == http.StatusServiceUnavailable, code)
+
+	res := q.done()
+	assert.DeepEqual(t, q.codes, []int{http.StatusOK, http.StatusOK, http.StatusOK})
+	assert.Assert(t, res.Queue == 0, res.Queue)
+	assert.Assert(t, res.Pending == 0, res.Pending)
+	assert.Assert(t, res.QueueWait.Size == 2, res.QueueWait)
+}
+
+func Test_Queue02(t *testing.T) {
+	q := new_queue_test(2, 2)
+
+	// request context ends while waiting
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	code := q.serve(ctx)
+	assert.Assert(t, code == http.StatusServiceUnavailable, code)
+
+	res := q.done()
+	assert.DeepEqual(t, q.codes, []int{http.StatusOK, http.StatusOK})
+	assert.Assert(t, res.QueueWait.Size == 2, res.QueueWait)
+	assert.Assert(t, res.QueueWait.Max >= time.Millisecond, res.QueueWait)
+}
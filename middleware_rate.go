@@ -0,0 +1,57 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/ondi/go-tst"
+)
+
+// token bucket, Rate is requests per second, 0 = no limit.
+// Burst is bucket size, less than 1 is 1.
+type Rate_t struct {
+	Rate  float64 `json:"rate"`
+	Burst float64 `json:"burst"`
+}
+
+// requests of page over rate are passed to next_failed and counted as REJECT/RATELIMIT tag.
+// routes are matched by longest prefix of r.URL.Path, rate is default.
+// has to be called before ServeHTTP
+func (self *Middleware_t[Key_t]) SetRateLimit(rate Rate_t, routes map[string]Rate_t) {
+	self.rate = rate
+	self.rate_routes = tst.NewTree3[Rate_t]()
+	for k, v := range routes {
+		self.rate_routes.Add(k, v)
+	}
+}
+
+func (self *Middleware_t[Key_t]) rate_get(r *http.Request) Rate_t {
+	if self.rate_routes != nil {
+		if value, _, found := self.rate_routes.Search(r.URL.Path); found > 0 {
+			return value
+		}
+	}
+	return self.rate
+}
+
+// bucket starts full
+func (self *Counter_t) rate_take(ts time.Time, rate Rate_t) (ok bool) {
+	burst := math.Max(rate.Burst, 1)
+	self.mx.Lock()
+	if self.tokens_ts.IsZero() {
+		self.tokens = burst
+	} else if elapsed := ts.Sub(self.tokens_ts).Seconds(); elapsed > 0 {
+		self.tokens = math.Min(burst, self.tokens+elapsed*rate.Rate)
+	}
+	self.tokens_ts = ts
+	if ok = self.tokens >= 1; ok {
+		self.tokens--
+	}
+	self.mx.Unlock()
+	return
+}
@@ -0,0 +1,88 @@
+//
+// go test -run Test_Rate -v -count=1
+//
+
+package ministat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Rate01(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	s.SetClock(clock)
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	m := NewMiddleware[Page_t](s, passed, failed, nil, GetPageName, 10, nil)
+	m.SetClock(clock)
+	m.SetRateLimit(Rate_t{Rate: 1, Burst: 2}, map[string]Rate_t{"/export": {Rate: 0.1, Burst: 1}, "/search": {}})
+
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	// burst
+	assert.Assert(t, serve("/page") == http.StatusOK)
+	assert.Assert(t, serve("/page") == http.StatusOK)
+	assert.Assert(t, serve("/page") == http.StatusTooManyRequests)
+
+	// refill
+	clock.Add(time.Second)
+	assert.Assert(t, serve("/page") == http.StatusOK)
+	assert.Assert(t, serve("/page") == http.StatusTooManyRequests)
+
+	res, _ := s.HitStat(s.Now(), Page_t{Name: "/page"})
+	assert.Assert(t, res.Hits == 5, res.Hits)
+	v, ok := res.Value("tag", REJECT, "RATELIMIT")
+	assert.Assert(t, ok && v == 2, v)
+	v, _ = res.Value("tag", "CODE", "429")
+	assert.Assert(t, v == 2, v)
+
+	// route limits
+	assert.Assert(t, serve("/export/csv") == http.StatusOK)
+	clock.Add(5 * time.Second)
+	assert.Assert(t, serve("/export/csv") == http.StatusTooManyRequests)
+	clock.Add(5 * time.Second)
+	assert.Assert(t, serve("/export/csv") == http.StatusOK)
+
+	// no limit
+	for i := 0; i < 10; i++ {
+		assert.Assert(t, serve("/search") == http.StatusOK)
+	}
+}
+
+// burst 0 is 1
+func Test_Rate02(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	s.SetClock(clock)
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	m := NewMiddleware[Page_t](s, http.NotFoundHandler(), failed, nil, GetPageName, 10, nil)
+	m.SetClock(clock)
+	m.SetRateLimit(Rate_t{Rate: 100}, nil)
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+		return w.Code
+	}
+
+	for i := 0; i < 50; i++ {
+		assert.Assert(t, serve() == http.StatusNotFound, i)
+		clock.Add(10 * time.Millisecond)
+	}
+	assert.Assert(t, serve() == http.StatusNotFound)
+	assert.Assert(t, serve() == http.StatusTooManyRequests)
+}
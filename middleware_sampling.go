@@ -0,0 +1,259 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"iter"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ondi/go-tst"
+)
+
+// example for Page_t
+func PageName(page Page_t) string {
+	return page.Name
+}
+
+// Value replaces sampling of counter, 0 disables page.
+// Percent of requests are passed if Value > 0, 0 = all requests.
+type SamplingRule_t struct {
+	Value   int64   `json:"value"`
+	Percent float64 `json:"percent,omitzero"`
+}
+
+// sampling of counter grows with every hit, so page can not be disabled through CounterAdd.
+// rules replace sampling of pages by name or by longest prefix of name, page rule goes first.
+// middleware passes requests only if sampling > 0.
+type Sampling_t[Key_t comparable] struct {
+	mx         sync.RWMutex
+	name       PageClass_t[Key_t]
+	pages      map[string]SamplingRule_t
+	prefixes   map[string]SamplingRule_t
+	tree       *tst.Tree3_t[SamplingRule_t]
+	get_client GetClient_t
+	log_write  LogWrite_t
+}
+
+func NewSampling[Key_t comparable](name PageClass_t[Key_t], log_write LogWrite_t) *Sampling_t[Key_t] {
+	return &Sampling_t[Key_t]{
+		name:      name,
+		pages:     map[string]SamplingRule_t{},
+		prefixes:  map[string]SamplingRule_t{},
+		tree:      tst.NewTree3[SamplingRule_t](),
+		log_write: log_write,
+	}
+}
+
+// requests with the same client key are passed or not for the same percent,
+// requests without key are chosen randomly.
+// has to be called before use
+func (self *Sampling_t[Key_t]) SetClient(get_client GetClient_t) {
+	self.get_client = get_client
+}
+
+func (self *Sampling_t[Key_t]) Get(page Key_t) (rule SamplingRule_t, ok bool) {
+	name := self.name(page)
+	self.mx.RLock()
+	defer self.mx.RUnlock()
+	if rule, ok = self.pages[name]; ok {
+		return
+	}
+	rule, _, found := self.tree.Search(name)
+	return rule, found > 0
+}
+
+// sampling of page by rule, 0 if request is out of percent
+func (self *Sampling_t[Key_t]) sample(r *http.Request, page Key_t) (value int64, ok bool) {
+	rule, ok := self.Get(page)
+	if value = rule.Value; ok && value > 0 && rule.Percent > 0 && self.bucket(r) >= rule.Percent {
+		value = 0
+	}
+	return
+}
+
+// in [0, 100)
+func (self *Sampling_t[Key_t]) bucket(r *http.Request) float64 {
+	if self.get_client != nil {
+		if client := self.get_client(r); len(client) > 0 {
+			h := fnv.New32a()
+			h.Write([]byte(client))
+			return float64(h.Sum32()%10000) / 100
+		}
+	}
+	return rand.Float64() * 100
+}
+
+func (self *Sampling_t[Key_t]) SetPage(name string, rule SamplingRule_t) {
+	self.mx.Lock()
+	self.pages[name] = rule
+	self.mx.Unlock()
+}
+
+func (self *Sampling_t[Key_t]) SetPrefix(prefix string, rule SamplingRule_t) {
+	self.mx.Lock()
+	self.prefixes[prefix] = rule
+	self.tree.Add(prefix, rule)
+	self.mx.Unlock()
+}
+
+func (self *Sampling_t[Key_t]) RemovePage(name string) (ok bool) {
+	self.mx.Lock()
+	if _, ok = self.pages[name]; ok {
+		delete(self.pages, name)
+	}
+	self.mx.Unlock()
+	return
+}
+
+// tree is rebuilt
+func (self *Sampling_t[Key_t]) RemovePrefix(prefix string) (ok bool) {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	if _, ok = self.prefixes[prefix]; ok {
+		delete(self.prefixes, prefix)
+		self.tree = tst.NewTree3[SamplingRule_t]()
+		for k, v := range self.prefixes {
+			self.tree.Add(k, v)
+		}
+	}
+	return
+}
+
+type SamplingRules_t struct {
+	Pages    map[string]SamplingRule_t `json:"pages"`
+	Prefixes map[string]SamplingRule_t `json:"prefixes"`
+}
+
+func (self *Sampling_t[Key_t]) Rules() (out SamplingRules_t) {
+	out = SamplingRules_t{Pages: map[string]SamplingRule_t{}, Prefixes: map[string]SamplingRule_t{}}
+	self.mx.RLock()
+	for k, v := range self.pages {
+		out.Pages[k] = v
+	}
+	for k, v := range self.prefixes {
+		out.Prefixes[k] = v
+	}
+	self.mx.RUnlock()
+	return
+}
+
+// pages with rule use its value and percent instead of sampling of counter.
+// has to be called before ServeHTTP
+func (self *Middleware_t[Key_t]) SetSampling(sampling *Sampling_t[Key_t]) {
+	self.sampling = sampling
+}
+
+// implemented by Storage_t and Sharded_t
+type Pages[Key_t comparable] interface {
+	AllStat(ts time.Time) iter.Seq2[Key_t, Stat_t]
+	Now() time.Time
+}
+
+type SamplingPage_t struct {
+	Name     string  `json:"name"`
+	Sampling int64   `json:"sampling"`
+	Percent  float64 `json:"percent,omitzero"`
+	Rule     bool    `json:"rule"` // sampling is set by rule
+}
+
+type SamplingList_t struct {
+	Pages []SamplingPage_t `json:"pages"`
+	Rules SamplingRules_t  `json:"rules"`
+}
+
+// GET lists pages and rules.
+// POST ?page=name&value=N or ?prefix=prefix&value=N sets rule, value 0 disables pages,
+// optional &percent=P passes P percent of requests.
+// DELETE ?page=name or ?prefix=prefix removes rule.
+// changes are logged with log_write
+type SamplingHandler_t[Key_t comparable] struct {
+	sampling *Sampling_t[Key_t]
+	storage  Pages[Key_t]
+}
+
+func NewSamplingHandler[Key_t comparable](sampling *Sampling_t[Key_t], storage Pages[Key_t]) *SamplingHandler_t[Key_t] {
+	return &SamplingHandler_t[Key_t]{
+		sampling: sampling,
+		storage:  storage,
+	}
+}
+
+func (self *SamplingHandler_t[Key_t]) List() (out SamplingList_t) {
+	for page, res := range self.storage.AllStat(self.storage.Now()) {
+		v := SamplingPage_t{Name: self.sampling.name(page), Sampling: res.Sampling}
+		if rule, ok := self.sampling.Get(page); ok {
+			v.Sampling, v.Percent, v.Rule = rule.Value, rule.Percent, true
+		}
+		out.Pages = append(out.Pages, v)
+	}
+	sort.Slice(out.Pages, func(i int, j int) bool {
+		return out.Pages[i].Name < out.Pages[j].Name
+	})
+	out.Rules = self.sampling.Rules()
+	return
+}
+
+func (self *SamplingHandler_t[Key_t]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, prefix := query.Get("page"), query.Get("prefix")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var rule SamplingRule_t
+		var err error
+		rule.Value, err = strconv.ParseInt(query.Get("value"), 10, 64)
+		if err == nil && query.Has("percent") {
+			rule.Percent, err = strconv.ParseFloat(query.Get("percent"), 64)
+		}
+		if err != nil || rule.Percent < 0 || len(page) == 0 && len(prefix) == 0 {
+			StatusBody_t{Error: StatusBodyError_t{Code: http.StatusBadRequest, Message: "page or prefix and value required"}}.ServeHTTP(w, r)
+			return
+		}
+		if len(page) > 0 {
+			self.sampling.SetPage(page, rule)
+			self.audit(r, "SAMPLING SET: page=%q, value=%v, percent=%v", page, rule.Value, rule.Percent)
+		} else {
+			self.sampling.SetPrefix(prefix, rule)
+			self.audit(r, "SAMPLING SET: prefix=%q, value=%v, percent=%v", prefix, rule.Value, rule.Percent)
+		}
+	case http.MethodDelete:
+		if len(page) == 0 && len(prefix) == 0 {
+			StatusBody_t{Error: StatusBodyError_t{Code: http.StatusBadRequest, Message: "page or prefix required"}}.ServeHTTP(w, r)
+			return
+		}
+		var ok bool
+		if len(page) > 0 {
+			ok = self.sampling.RemovePage(page)
+			self.audit(r, "SAMPLING REMOVE: page=%q, found=%v", page, ok)
+		} else {
+			ok = self.sampling.RemovePrefix(prefix)
+			self.audit(r, "SAMPLING REMOVE: prefix=%q, found=%v", prefix, ok)
+		}
+		if ok == false {
+			StatusBody_t{Error: StatusBodyError_t{Code: http.StatusNotFound, Message: "rule not found"}}.ServeHTTP(w, r)
+			return
+		}
+	default:
+		StatusBody_t{Error: StatusBodyError_t{Code: http.StatusMethodNotAllowed}}.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "   ")
+	e.Encode(self.List())
+}
+
+func (self *SamplingHandler_t[Key_t]) audit(r *http.Request, format string, args ...any) {
+	if self.sampling.log_write != nil {
+		self.sampling.log_write(r.Context(), format+", remote=%v", append(args, r.RemoteAddr)...)
+	}
+}
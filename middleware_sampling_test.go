@@ -0,0 +1,119 @@
+//
+// go test -run Test_Sampling -v -count=1
+//
+
+package ministat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Sampling01(t *testing.T) {
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	var audit []string
+	sampling := NewSampling(PageName, func(ctx context.Context, format string, args ...any) {
+		audit = append(audit, fmt.Sprintf(format, args...))
+	})
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	m := NewMiddleware[Page_t](s, http.NotFoundHandler(), failed, nil, GetPageName, 10, nil)
+	m.SetSampling(sampling)
+	admin := NewSamplingHandler(sampling, s)
+
+	serve := func(h http.Handler, method string, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Assert(t, serve(m, http.MethodGet, "/api/a").Code == http.StatusNotFound)
+	assert.Assert(t, serve(m, http.MethodGet, "/api/b").Code == http.StatusNotFound)
+
+	// disable prefix, enable one page
+	assert.Assert(t, serve(admin, http.MethodPost, "/?prefix=/api&value=0").Code == http.StatusOK)
+	assert.Assert(t, serve(admin, http.MethodPost, "/?page=/api/b&value=1").Code == http.StatusOK)
+	assert.Assert(t, serve(m, http.MethodGet, "/api/a").Code == http.StatusServiceUnavailable)
+	assert.Assert(t, serve(m, http.MethodGet, "/api/b").Code == http.StatusNotFound)
+	assert.Assert(t, serve(m, http.MethodGet, "/api/c").Code == http.StatusServiceUnavailable)
+	assert.Assert(t, serve(m, http.MethodGet, "/other").Code == http.StatusNotFound)
+
+	var list SamplingList_t
+	w := serve(admin, http.MethodGet, "/")
+	assert.NilError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.DeepEqual(t, list.Pages, []SamplingPage_t{
+		{Name: "/api/a", Sampling: 0, Rule: true},
+		{Name: "/api/b", Sampling: 1, Rule: true},
+		{Name: "/api/c", Sampling: 0, Rule: true},
+		{Name: "/other", Sampling: 1},
+	})
+	assert.DeepEqual(t, list.Rules, SamplingRules_t{Pages: map[string]SamplingRule_t{"/api/b": {Value: 1}}, Prefixes: map[string]SamplingRule_t{"/api": {}}})
+
+	// enable prefix again
+	assert.Assert(t, serve(admin, http.MethodDelete, "/?prefix=/api").Code == http.StatusOK)
+	assert.Assert(t, serve(admin, http.MethodDelete, "/?prefix=/api").Code == http.StatusNotFound)
+	assert.Assert(t, serve(m, http.MethodGet, "/api/a").Code == http.StatusNotFound)
+
+	assert.Assert(t, serve(admin, http.MethodPost, "/?page=/api/a").Code == http.StatusBadRequest)
+	assert.Assert(t, serve(admin, http.MethodDelete, "/").Code == http.StatusBadRequest)
+	assert.Assert(t, serve(admin, http.MethodPut, "/").Code == http.StatusMethodNotAllowed)
+
+	assert.DeepEqual(t, audit, []string{
+		`SAMPLING SET: prefix="/api", value=0, percent=0, remote=10.0.0.1:1234`,
+		`SAMPLING SET: page="/api/b", value=1, percent=0, remote=10.0.0.1:1234`,
+		`SAMPLING REMOVE: prefix="/api", found=true, remote=10.0.0.1:1234`,
+		`SAMPLING REMOVE: prefix="/api", found=false, remote=10.0.0.1:1234`,
+	})
+}
+
+func Test_Sampling02(t *testing.T) {
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	sampling := NewSampling(PageName, nil)
+	sampling.SetClient(GetClientHeader("X-Api-Key"))
+	sampling.SetPrefix("/new", SamplingRule_t{Value: 1, Percent: 5})
+	m := NewMiddleware[Page_t](s, http.NotFoundHandler(), NewOverload(time.Second, time.Second), nil, GetPageName, 1000, nil)
+	m.SetSampling(sampling)
+
+	serve := func(client string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/new/page", nil)
+		r.Header.Set("X-Api-Key", client)
+		m.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	var passed int
+	for i := 0; i < 1000; i++ {
+		client := fmt.Sprintf("client-%d", i)
+		code := serve(client)
+		if code == http.StatusNotFound {
+			passed++
+		}
+		// same client goes the same way
+		assert.Assert(t, serve(client) == code, client)
+	}
+	assert.Assert(t, passed > 20 && passed < 80, passed)
+
+	// random without client key
+	passed = 0
+	for i := 0; i < 1000; i++ {
+		if serve("") == http.StatusNotFound {
+			passed++
+		}
+	}
+	assert.Assert(t, passed > 10 && passed < 100, passed)
+
+	res, _ := s.HitStat(time.Now(), Page_t{Name: "/new/page"})
+	v, _ := res.Value("tag", REJECT, REJECT_SAMPLING)
+	assert.Assert(t, v > 2500, v)
+}
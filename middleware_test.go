@@ -0,0 +1,75 @@
+//
+// go test -run Test_Middleware -v -count=1
+//
+
+package ministat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Middleware01(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	s.SetClock(clock)
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Add(100 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+	})
+	m := NewMiddleware[Page_t](s, passed, http.NotFoundHandler(), nil, GetPageName, 10, nil)
+	m.SetClock(clock)
+
+	for i := 0; i < 3; i++ {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/page", nil))
+		clock.Add(time.Second)
+	}
+
+	res, ok := s.HitStat(s.Now(), Page_t{Name: "/page"})
+	assert.Assert(t, ok)
+	assert.Assert(t, res.Rpm == 3, res.Rpm)
+	assert.Assert(t, res.Latency.Med == 100*time.Millisecond, res.Latency)
+	assert.Assert(t, res.Latency.Size == 3, res.Latency)
+	assert.Assert(t, res.Idle == 1100*time.Millisecond, res.Idle)
+	assert.Assert(t, res.Tags[0] == TagValue_t{Level: "CODE", Key: "201", Value: 3}, res.Tags)
+
+	// latency window expires after 10 seconds
+	clock.Add(8 * time.Second)
+	res, _ = s.HitStat(s.Now(), Page_t{Name: "/page"})
+	assert.Assert(t, res.Latency.Size == 1, res.Latency)
+
+	// rpm window expires after 60 seconds
+	clock.Add(60 * time.Second)
+	res, _ = s.HitStat(s.Now(), Page_t{Name: "/page"})
+	assert.Assert(t, res.Rpm == 0, res.Rpm)
+	assert.Assert(t, res.Latency.Size == 0, res.Latency)
+	assert.Assert(t, s.HitEvictIdle(s.Now(), time.Minute) == 1)
+}
+
+type limiter_test_t int64
+
+func (self limiter_test_t) PendingLimit(r *http.Request, page Page_t, counter *Counter_t, ts time.Time) int64 {
+	return int64(self)
+}
+
+func Test_Middleware02(t *testing.T) {
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	m := NewMiddleware[Page_t](s, http.NotFoundHandler(), failed, nil, GetPageName, 10, nil)
+	m.SetLimiter(limiter_test_t(0))
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+	assert.Assert(t, w.Code == http.StatusServiceUnavailable, w.Code)
+
+	m.SetLimiter(limiter_test_t(1))
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+	assert.Assert(t, w.Code == http.StatusNotFound, w.Code)
+}
@@ -73,6 +73,70 @@ func (self *Average_t[T]) Value(ts time.Time) (value T, count int64) {
 	return
 }
 
+func (self *Average_t[T]) Size() int {
+	return self.cx.Size()
+}
+
+type AverageBucket_t[T Number] struct {
+	Ts    time.Time `json:"ts"` // expiration time
+	Data  T         `json:"data"`
+	Count T         `json:"count"`
+}
+
+type AverageSnapshot_t[T Number] struct {
+	Buckets []AverageBucket_t[T] `json:"buckets"`
+}
+
+func (self *Average_t[T]) Snapshot(ts time.Time) (out AverageSnapshot_t[T]) {
+	self.Evict(ts)
+	for it := self.cx.Front(); it != self.cx.End(); it = it.Next() {
+		out.Buckets = append(out.Buckets, AverageBucket_t[T]{Ts: it.Key, Data: it.Value.Data, Count: it.Value.Count})
+	}
+	return
+}
+
+// replaces current buckets
+func (self *Average_t[T]) Restore(in AverageSnapshot_t[T]) {
+	self.cx.Clear()
+	self.total_sum = 0
+	self.total_count = 0
+	for _, v := range in.Buckets {
+		self.add_bucket(v)
+	}
+	self.Evict(time.Time{})
+}
+
+// sums buckets with the same expiration time
+func (self *Average_t[T]) Merge(in AverageSnapshot_t[T]) {
+	for _, v := range in.Buckets {
+		self.add_bucket(v)
+	}
+	self.Evict(time.Time{})
+}
+
+// keeps buckets sorted by expiration time
+func (self *Average_t[T]) add_bucket(in AverageBucket_t[T]) {
+	it, inserted := self.cx.CreateBack(
+		in.Ts,
+		func(p *AverageMapped_t[T]) {
+			p.Data = in.Data
+			p.Count = in.Count
+		},
+		func(p *AverageMapped_t[T]) {
+			p.Data += in.Data
+			p.Count += in.Count
+		},
+	)
+	if inserted {
+		at := it.Prev()
+		for ; at != self.cx.End() && at.Key.After(in.Ts); at = at.Prev() {
+		}
+		cache.MoveNext(it, at)
+	}
+	self.total_sum += in.Data
+	self.total_count += in.Count
+}
+
 func (self *Average_t[T]) range_test(ts time.Time, f func(key time.Time, value AverageMapped_t[T]) bool) {
 	self.Evict(ts)
 	for it := self.cx.Front(); it != self.cx.End(); it = it.Next() {
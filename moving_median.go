@@ -5,6 +5,7 @@
 package ministat
 
 import (
+	"sort"
 	"time"
 
 	"github.com/ondi/go-cache"
@@ -143,7 +144,6 @@ func (self *Median_t[T]) Evict(ts time.Time) int {
 			return self.cx.Size()
 		}
 	}
-	return 0
 }
 
 func (self *Median_t[T]) begin() (begin int) {
@@ -180,6 +180,63 @@ func (self *Median_t[T]) remove(it *cache.Value_t[int, MedianMapped_t[T]]) {
 	self.move_median()
 }
 
+type MedianSnapshot_t[T Number] struct {
+	Items []MedianMapped_t[T] `json:"items"` // oldest first, Ts is expiration time
+}
+
+func (self *Median_t[T]) Snapshot(ts time.Time) (out MedianSnapshot_t[T]) {
+	size := self.Evict(ts)
+	begin := self.begin()
+	for ; size > 0; size-- {
+		if it, ok := self.cx.Find(begin); ok {
+			out.Items = append(out.Items, it.Value)
+		}
+		if begin++; begin >= self.limit {
+			begin = 0
+		}
+	}
+	return
+}
+
+// replaces current window, expiration time of items is preserved
+func (self *Median_t[T]) Restore(in MedianSnapshot_t[T]) {
+	self.cx.Clear()
+	self.median = self.cx.End()
+	self.sum = 0
+	self.seq = 0
+	self.left = 0
+	self.right = -1
+	for _, v := range in.Items {
+		self.Add(v.Ts.Add(-self.ttl), v.Data)
+	}
+}
+
+// keeps newest items
+func (self *Median_t[T]) Resize(limit int) {
+	temp := self.Snapshot(time.Time{})
+	self.limit = limit
+	self.Restore(temp)
+}
+
+// minimum of window, call after Value or Add
+func (self *Median_t[T]) Min() T {
+	return self.cx.Front().Value.Data
+}
+
+func (self *Median_t[T]) Size() int {
+	return self.cx.Size()
+}
+
+// combines windows ordered by expiration time, oldest items are dropped above limit
+func (self *Median_t[T]) Merge(in MedianSnapshot_t[T]) {
+	temp := self.Snapshot(time.Time{})
+	temp.Items = append(temp.Items, in.Items...)
+	sort.SliceStable(temp.Items, func(i int, j int) bool {
+		return temp.Items[i].Ts.Before(temp.Items[j].Ts)
+	})
+	self.Restore(temp)
+}
+
 func (self *Median_t[T]) range_test(ts time.Time, f func(key int, value MedianMapped_t[T]) bool) {
 	self.Evict(ts)
 	for it := self.cx.Front(); it != self.cx.End(); it = it.Next() {
@@ -0,0 +1,86 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"time"
+
+	"github.com/ondi/go-cache"
+)
+
+type PageClass_t[Key_t comparable] func(page Key_t) string
+
+// example for Page_t
+func PageEntry(page Page_t) string {
+	return page.Entry
+}
+
+type classes_t[Key_t comparable] struct {
+	class         PageClass_t[Key_t]
+	class_limits  map[string]int
+	class_default int
+	pages         map[string]*cache.Cache_t[Key_t, *Counter_t]
+}
+
+// limit_pages is global limit, class_limits limit pages of each class,
+// class_default is limit for classes not in class_limits, 0 = no limit.
+// page evicted for class limit is always from the same class.
+func NewStorageClass[Key_t comparable](limit_pages int, median_limit int, median_ttl time.Duration, evict func(page Key_t, value *Counter_t),
+	class PageClass_t[Key_t], class_limits map[string]int, class_default int) (self *Storage_t[Key_t]) {
+	self = NewStorage(limit_pages, median_limit, median_ttl, evict)
+	self.classes = &classes_t[Key_t]{
+		class:         class,
+		class_limits:  class_limits,
+		class_default: class_default,
+		pages:         map[string]*cache.Cache_t[Key_t, *Counter_t]{},
+	}
+	return
+}
+
+func (self *classes_t[Key_t]) limit(class string) int {
+	if limit, ok := self.class_limits[class]; ok {
+		return limit
+	}
+	return self.class_default
+}
+
+// same policy as unique.Often_t within class
+func (self *classes_t[Key_t]) insert(storage *Storage_t[Key_t], page Key_t, counter *Counter_t) {
+	class := self.class(page)
+	pages := self.pages[class]
+	if pages == nil {
+		pages = cache.New[Key_t, *Counter_t]()
+		self.pages[class] = pages
+	}
+	pages.CreateBack(page, func(p **Counter_t) { *p = counter }, func(p **Counter_t) { *p = counter })
+	limit := self.limit(class)
+	if limit <= 0 || pages.Size() <= limit {
+		return
+	}
+	for it := pages.Front(); it != pages.End(); it = it.Next() {
+		if it.Value.CounterAdd(-1); it.Value.CounterGet() <= 0 {
+			storage.pages.Remove(it.Key)
+			storage.forget(it.Key)
+			storage.evict(it.Key, it.Value)
+			return
+		}
+	}
+}
+
+func (self *classes_t[Key_t]) remove(page Key_t) {
+	class := self.class(page)
+	if pages := self.pages[class]; pages != nil {
+		if pages.Remove(page); pages.Size() == 0 {
+			delete(self.pages, class)
+		}
+	}
+}
+
+func (self *classes_t[Key_t]) size(class string) (res int) {
+	if pages := self.pages[class]; pages != nil {
+		res = pages.Size()
+	}
+	return
+}
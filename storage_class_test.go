@@ -0,0 +1,44 @@
+//
+// go test -run Test_Class -v -count=1
+//
+
+package ministat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Class01(t *testing.T) {
+	var evicted []Page_t
+	s := NewStorageClass(100, 10, time.Second,
+		func(page Page_t, value *Counter_t) { evicted = append(evicted, page) },
+		PageEntry, map[string]int{"noisy": 3}, 10,
+	)
+
+	ts := time.Now()
+	for i := 0; i < 5; i++ {
+		s.HitBegin(Page_t{Entry: "quiet", Name: strconv.Itoa(i)}, ts)
+	}
+	for i := 0; i < 50; i++ {
+		s.HitBegin(Page_t{Entry: "noisy", Name: strconv.Itoa(i)}, ts)
+	}
+
+	assert.Assert(t, s.classes.size("noisy") == 3, s.classes.size("noisy"))
+	assert.Assert(t, s.classes.size("quiet") == 5, s.classes.size("quiet"))
+	assert.Assert(t, s.pages.Size() == 8, s.pages.Size())
+	assert.Assert(t, len(evicted) == 47, len(evicted))
+	for _, v := range evicted {
+		assert.Assert(t, v.Entry == "noisy", v)
+	}
+	for i := 0; i < 5; i++ {
+		_, ok := s.HitGet(ts, Page_t{Entry: "quiet", Name: strconv.Itoa(i)})
+		assert.Assert(t, ok, i)
+	}
+
+	assert.Assert(t, s.HitRemove(Page_t{Entry: "quiet", Name: "0"}))
+	assert.Assert(t, s.classes.size("quiet") == 4, s.classes.size("quiet"))
+}
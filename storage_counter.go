@@ -5,8 +5,10 @@
 package ministat
 
 import (
-	"sort"
+	"iter"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ondi/go-cache"
@@ -18,7 +20,37 @@ type Tag_t struct {
 	Level string
 }
 
+const STRIPES = 8
+
+// spreads increments over cache lines, Load is not atomic snapshot
+type Striped_t struct {
+	stripes [STRIPES]struct {
+		value atomic.Int64
+		_     [56]byte
+	}
+}
+
+func (self *Striped_t) Add(a int64) {
+	self.stripes[rand.Uint32()%STRIPES].value.Add(a)
+}
+
+func (self *Striped_t) Load() (res int64) {
+	for i := range self.stripes {
+		res += self.stripes[i].value.Load()
+	}
+	return
+}
+
+func (self *Striped_t) Store(a int64) {
+	for i := range self.stripes {
+		self.stripes[i].value.Store(0)
+	}
+	self.stripes[0].value.Store(a)
+}
+
+// hits, pending and sampling are atomic, mx guards windows, tags and timestamps
 type Counter_t struct {
+	mx           sync.Mutex
 	median       *Median_t[time.Duration]
 	average      *Average_t[time.Duration] // RPM
 	tags         map[Tag_t]int64
@@ -28,17 +60,78 @@ type Counter_t struct {
 	hit_end_avg  time.Duration
 	hit_end_max  time.Duration
 	hit_end_size int
-	hits         int64
-	pending      int64
-	sampling     int64
+	hits         Striped_t
+	pending      atomic.Int64
+	sampling     atomic.Int64
+	shard        int
+	rollup       []*Counter_t
+	limit        float64 // set by Limiter
+	limit_ts     time.Time
+	limit_rtt    float64                  // long term minimum latency
+	passed       *Median_t[time.Duration] // latency of passed requests for Limiter, created on first one
+	queue        atomic.Int64
+	queue_wait   *Median_t[time.Duration] // created on first wait
+	wake         chan struct{}            // pending decreased
+	tokens       float64                  // rate limit bucket
+	tokens_ts    time.Time
+	codel        *Median_t[time.Duration] // latency of passed requests, created on first one
+	codel_above  time.Time                // minimum latency above target since
 }
 
 func (self *Counter_t) CounterAdd(a int64) {
-	self.sampling += a
+	self.sampling.Add(a)
 }
 
 func (self *Counter_t) CounterGet() int64 {
-	return self.sampling
+	return self.sampling.Load()
+}
+
+func (self *Counter_t) hit_begin(begin time.Time) (pending int64, rpm int64) {
+	self.hits.Add(1)
+	pending = self.pending.Add(1)
+	self.mx.Lock()
+	self.hit_begin_ts = begin
+	_, rpm = self.average.Add(begin, 0)
+	self.mx.Unlock()
+	return
+}
+
+func (self *Counter_t) hit_end(begin time.Time, end time.Time, tags map[string]map[string]int64) {
+	self.pending.Add(-1)
+	self.mx.Lock()
+	for level, v1 := range tags {
+		for key, v2 := range v1 {
+			self.tags[Tag_t{Key: key, Level: level}] += v2
+		}
+	}
+	self.hit_end_ts = end
+	self.hit_end_med, self.hit_end_avg, self.hit_end_max, self.hit_end_size = self.median.Add(end, end.Sub(begin))
+	self.mx.Unlock()
+	self.wake_up()
+}
+
+// median of counter also has requests rejected by middleware
+func (self *Counter_t) passed_end(ts time.Time, latency time.Duration) {
+	self.mx.Lock()
+	if self.passed == nil {
+		self.passed = NewMedian[time.Duration](self.median.limit, self.median.ttl)
+	}
+	self.passed.Add(ts, latency)
+	self.mx.Unlock()
+}
+
+func (self *Counter_t) wake_up() {
+	select {
+	case self.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (self *Counter_t) median_value() (res time.Duration) {
+	self.mx.Lock()
+	res = self.median.median.Value.Data
+	self.mx.Unlock()
+	return
 }
 
 type Result_t struct {
@@ -50,63 +143,134 @@ type Result_t struct {
 
 func NoEvict[Key_t comparable](page Key_t, value *Counter_t) {}
 
+// mx guards pages, existing pages are found through index without lock
 type Storage_t[Key_t comparable] struct {
 	mx           sync.Mutex
+	index        sync.Map
 	pages        *unique.Often_t[Key_t, *Counter_t]
+	evict        func(page Key_t, value *Counter_t)
+	classes      *classes_t[Key_t]
+	rollup       *rollup_t[Key_t]
+	clock        Clock
+	memory_limit int64
+	memory_used  int64 // estimate, updated on every check
 	median_ttl   time.Duration
 	median_limit int
+	shard        int
 }
 
 func NewStorage[Key_t comparable](limit_pages int, median_limit int, median_ttl time.Duration, evict func(page Key_t, value *Counter_t)) (self *Storage_t[Key_t]) {
 	self = &Storage_t[Key_t]{
-		pages:        unique.NewOften(limit_pages, evict),
+		evict:        evict,
+		clock:        SystemClock_t{},
 		median_ttl:   median_ttl,
 		median_limit: median_limit,
 	}
+	self.pages = unique.NewOften(
+		limit_pages,
+		func(page Key_t, value *Counter_t) {
+			self.forget(page)
+			evict(page, value)
+		},
+	)
 	return
 }
 
-func (self *Storage_t[Key_t]) HitBegin(name Key_t, begin time.Time) (counter *Counter_t, sampling int64, pending int64, rpm int64) {
-	self.mx.Lock()
-	counter, _ = self.pages.Create(
+// has to be called before use
+func (self *Storage_t[Key_t]) SetClock(clock Clock) {
+	self.clock = clock
+}
+
+func (self *Storage_t[Key_t]) Now() time.Time {
+	return self.clock.Now()
+}
+
+func (self *Storage_t[Key_t]) new_counter() *Counter_t {
+	return &Counter_t{
+		median:  NewMedian[time.Duration](self.median_limit, self.median_ttl),
+		average: NewAverage[time.Duration](256, 60*time.Second),
+		tags:    map[Tag_t]int64{},
+		shard:   self.shard,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// counts hit for Often_t eviction
+func (self *Storage_t[Key_t]) create(name Key_t) (counter *Counter_t) {
+	counter, inserted := self.pages.Create(
 		name,
 		func(p **Counter_t) {
-			*p = &Counter_t{
-				median:  NewMedian[time.Duration](self.median_limit, self.median_ttl),
-				average: NewAverage[time.Duration](256, 60*time.Second),
-				tags:    map[Tag_t]int64{},
-			}
+			*p = self.new_counter()
 		},
 		func(**Counter_t) {},
 	)
-	counter.hits++
-	counter.pending++
-	counter.hit_begin_ts = begin
-	sampling = counter.sampling
-	pending = counter.pending
-	_, rpm = counter.average.Add(begin, 0)
-	self.mx.Unlock()
+	if inserted {
+		if self.rollup != nil {
+			counter.rollup = self.rollup.get(self, name)
+		}
+		// new page may be evicted by Create itself
+		if _, ok := self.pages.Get(name); ok == false {
+			return
+		}
+		self.index.Store(name, counter)
+		if self.classes != nil {
+			self.classes.insert(self, name, counter)
+		}
+		if self.memory_limit > 0 {
+			if self.memory_used += self.page_memory(counter); self.memory_used > self.memory_limit {
+				self.enforce_memory(func(key Key_t) bool { return key == name })
+			}
+		}
+	}
+	return
+}
+
+// page is removed from pages
+func (self *Storage_t[Key_t]) forget(name Key_t) {
+	self.index.Delete(name)
+	if self.classes != nil {
+		self.classes.remove(name)
+	}
+}
+
+// existing pages do not take storage lock
+func (self *Storage_t[Key_t]) HitBegin(name Key_t, begin time.Time) (counter *Counter_t, sampling int64, pending int64, rpm int64) {
+	if temp, ok := self.index.Load(name); ok {
+		counter = temp.(*Counter_t)
+		counter.CounterAdd(1)
+	} else {
+		self.mx.Lock()
+		counter = self.create(name)
+		self.mx.Unlock()
+	}
+	sampling = counter.sampling.Load()
+	pending, rpm = counter.hit_begin(begin)
+	for _, v := range counter.rollup {
+		v.hit_begin(begin)
+	}
 	return
 }
 
 func (self *Storage_t[Key_t]) HitEnd(counter *Counter_t, begin time.Time, end time.Time, tags map[string]map[string]int64) {
-	self.mx.Lock()
-	counter.pending--
-	for level, v1 := range tags {
-		for key, v2 := range v1 {
-			counter.tags[Tag_t{Key: key, Level: level}] += v2
-		}
+	counter.hit_end(begin, end, tags)
+	for _, v := range counter.rollup {
+		v.hit_end(begin, end, tags)
 	}
-	counter.hit_end_ts = end
-	counter.hit_end_med, counter.hit_end_avg, counter.hit_end_max, counter.hit_end_size = counter.median.Add(end, end.Sub(begin))
-	self.mx.Unlock()
 }
 
 func (self *Storage_t[Key_t]) HitGet(ts time.Time, name Key_t) (out Result_t, ok bool) {
+	res, ok := self.HitStat(ts, name)
+	if ok {
+		out = res.Result()
+	}
+	return
+}
+
+func (self *Storage_t[Key_t]) HitStat(ts time.Time, name Key_t) (out Stat_t, ok bool) {
 	self.mx.Lock()
 	res, ok := self.pages.Get(name)
 	if ok {
-		out = ToResult(res, ts)
+		out = ToStat(res, ts)
 	}
 	self.mx.Unlock()
 	return
@@ -114,7 +278,9 @@ func (self *Storage_t[Key_t]) HitGet(ts time.Time, name Key_t) (out Result_t, ok
 
 func (self *Storage_t[Key_t]) HitRemove(name Key_t) (ok bool) {
 	self.mx.Lock()
-	ok = self.pages.Remove(name)
+	if ok = self.pages.Remove(name); ok {
+		self.forget(name)
+	}
 	self.mx.Unlock()
 	return
 }
@@ -125,6 +291,7 @@ func (self *Storage_t[Key_t]) HitRemoveRange(cmp func(Key_t) bool) {
 		func(key Key_t, value *Counter_t) bool {
 			if cmp(key) {
 				self.pages.Remove(key)
+				self.forget(key)
 			}
 			return true
 		},
@@ -132,25 +299,72 @@ func (self *Storage_t[Key_t]) HitRemoveRange(cmp func(Key_t) bool) {
 	self.mx.Unlock()
 }
 
-func (self *Storage_t[Key_t]) RangeSort(ts time.Time, order cache.Less_t[Key_t, *Counter_t], f func(name Key_t, res Result_t) bool) {
+type PageResult_t[Key_t comparable] struct {
+	Page   Key_t
+	Result Result_t
+}
+
+type PageStat_t[Key_t comparable] struct {
+	Page Key_t
+	Stat Stat_t
+}
+
+// order may be nil
+func (self *Storage_t[Key_t]) Results(ts time.Time, order cache.Less_t[Key_t, *Counter_t]) (out []PageResult_t[Key_t]) {
+	return ToResults(self.Stats(ts, order))
+}
+
+// copies stats under lock, order may be nil
+func (self *Storage_t[Key_t]) Stats(ts time.Time, order cache.Less_t[Key_t, *Counter_t]) (out []PageStat_t[Key_t]) {
 	self.mx.Lock()
-	self.pages.RangeSort(
-		order,
-		func(key Key_t, value *Counter_t) bool {
-			return f(key, ToResult(value, ts))
-		},
-	)
+	out = make([]PageStat_t[Key_t], 0, self.pages.Size())
+	f := func(key Key_t, value *Counter_t) bool {
+		out = append(out, PageStat_t[Key_t]{Page: key, Stat: ToStat(value, ts)})
+		return true
+	}
+	if order == nil {
+		self.pages.Range(f)
+	} else {
+		self.pages.RangeSort(order, f)
+	}
 	self.mx.Unlock()
+	return
 }
 
+// f is called without lock
+func (self *Storage_t[Key_t]) RangeSort(ts time.Time, order cache.Less_t[Key_t, *Counter_t], f func(name Key_t, res Result_t) bool) {
+	for _, v := range self.Results(ts, order) {
+		if f(v.Page, v.Result) == false {
+			return
+		}
+	}
+}
+
+// f is called without lock
 func (self *Storage_t[Key_t]) Range(ts time.Time, f func(name Key_t, res Result_t) bool) {
-	self.mx.Lock()
-	self.pages.Range(
-		func(key Key_t, value *Counter_t) bool {
-			return f(key, ToResult(value, ts))
-		},
-	)
-	self.mx.Unlock()
+	self.RangeSort(ts, nil, f)
+}
+
+func (self *Storage_t[Key_t]) All(ts time.Time) iter.Seq2[Key_t, Result_t] {
+	return func(yield func(Key_t, Result_t) bool) {
+		self.Range(ts, yield)
+	}
+}
+
+func (self *Storage_t[Key_t]) AllStat(ts time.Time) iter.Seq2[Key_t, Stat_t] {
+	return func(yield func(Key_t, Stat_t) bool) {
+		for _, v := range self.Stats(ts, nil) {
+			if yield(v.Page, v.Stat) == false {
+				return
+			}
+		}
+	}
+}
+
+func (self *Storage_t[Key_t]) Sorted(ts time.Time, order cache.Less_t[Key_t, *Counter_t]) iter.Seq2[Key_t, Result_t] {
+	return func(yield func(Key_t, Result_t) bool) {
+		self.RangeSort(ts, order, yield)
+	}
 }
 
 type Less_t[Key_t comparable] struct {
@@ -163,53 +377,9 @@ func LessPage(a *cache.Value_t[Page_t, *Counter_t], b *cache.Value_t[Page_t, *Co
 }
 
 func LessHits[Key_t comparable](a *cache.Value_t[Key_t, *Counter_t], b *cache.Value_t[Key_t, *Counter_t]) bool {
-	return a.Value.hits < b.Value.hits
+	return a.Value.hits.Load() < b.Value.hits.Load()
 }
 
 func LessDuration[Key_t comparable](a *cache.Value_t[Key_t, *Counter_t], b *cache.Value_t[Key_t, *Counter_t]) bool {
-	return a.Value.median.median.Value.Data < b.Value.median.median.Value.Data
-}
-
-func ToResult(in *Counter_t, ts time.Time) (out Result_t) {
-	out.BeginTs = in.hit_begin_ts
-	out.EndTs = in.hit_end_ts
-
-	_, rpm := in.average.Value(ts)
-	out.GaugeLast = append(out.GaugeLast,
-		Gauge_t[int64]{Name: "rpm", Value: rpm},
-		Gauge_t[int64]{Name: "hits", Value: in.hits},
-		Gauge_t[int64]{Name: "pending", Value: in.pending},
-		Gauge_t[time.Duration]{Name: "idle", Value: ts.Sub(in.hit_begin_ts)},
-		Gauge_t[time.Duration]{Name: "latency/med", Value: in.hit_end_med},
-		Gauge_t[time.Duration]{Name: "latency/avg", Value: in.hit_end_avg},
-		Gauge_t[time.Duration]{Name: "latency/max", Value: in.hit_end_max},
-		Gauge_t[int64]{Name: "latency/size", Value: int64(in.hit_end_size)},
-	)
-
-	med, avg, max, size := in.median.Value(ts)
-	out.GaugeCurrent = append(out.GaugeCurrent,
-		Gauge_t[int64]{Name: "rpm", Value: rpm},
-		Gauge_t[int64]{Name: "hits", Value: in.hits},
-		Gauge_t[int64]{Name: "pending", Value: in.pending},
-		Gauge_t[time.Duration]{Name: "idle", Value: ts.Sub(in.hit_begin_ts)},
-		Gauge_t[time.Duration]{Name: "latency/med", Value: med},
-		Gauge_t[time.Duration]{Name: "latency/avg", Value: avg},
-		Gauge_t[time.Duration]{Name: "latency/max", Value: max},
-		Gauge_t[int64]{Name: "latency/size", Value: int64(size)},
-	)
-
-	var tempLast, tempCurrent GaugeList_t[int64]
-	for k, v := range in.tags {
-		tempLast = append(tempLast, Gauge_t[int64]{Name: "tag", Level: k.Level, Tag: k.Key, Value: v})
-		tempCurrent = append(tempCurrent, Gauge_t[int64]{Name: "tag", Level: k.Level, Tag: k.Key, Value: v})
-	}
-	sort.Sort(sort.Reverse(tempLast))
-	sort.Sort(sort.Reverse(tempCurrent))
-	for _, v := range tempLast {
-		out.GaugeLast = append(out.GaugeLast, v)
-	}
-	for _, v := range tempCurrent {
-		out.GaugeCurrent = append(out.GaugeCurrent, v)
-	}
-	return
+	return a.Value.median_value() < b.Value.median_value()
 }
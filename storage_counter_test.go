@@ -1,11 +1,12 @@
 //
-//
+// go test -run NONE -bench SamePage -cpu 64
 //
 
 package ministat
 
 import (
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -35,6 +36,30 @@ func Test_Evict02(t *testing.T) {
 	}
 }
 
+// new page evicted by Create must not stay in index
+func Test_Evict03(t *testing.T) {
+	s := NewStorage(2, 10, time.Second, NoEvict[string])
+
+	ts := time.Now()
+	for i := 0; i < 100; i++ {
+		s.HitBegin("hot1", ts)
+		s.HitBegin("hot2", ts)
+	}
+	for i := 0; i < 1000; i++ {
+		s.HitBegin("new-"+strconv.FormatInt(int64(i), 10), ts)
+	}
+
+	var index int
+	s.index.Range(func(key any, value any) bool {
+		index++
+		_, ok := s.pages.Get(key.(string))
+		assert.Assert(t, ok, key)
+		return true
+	})
+	assert.Assert(t, s.pages.Size() == 2, s.pages.Size())
+	assert.Assert(t, index == 2, index)
+}
+
 func Test_Get01(t *testing.T) {
 	s := NewStorage(1, 10, time.Second, NoEvict[string])
 
@@ -44,3 +69,58 @@ func Test_Get01(t *testing.T) {
 	assert.Assert(t, ok, ok)
 	assert.Assert(t, res.GaugeLast[0].GetValueInt64() == 1, res.GaugeLast)
 }
+
+func Test_Range01(t *testing.T) {
+	s := NewStorage(100, 10, time.Second, NoEvict[string])
+
+	ts := time.Now()
+	for i := int64(0); i < 10; i++ {
+		s.HitBegin("test1-"+strconv.FormatInt(i, 10), ts)
+	}
+	// callback is called without lock
+	var count int
+	for page := range s.All(ts) {
+		_, ok := s.HitGet(ts, page)
+		assert.Assert(t, ok, page)
+		if count++; count == 5 {
+			break
+		}
+	}
+	assert.Assert(t, count == 5, count)
+}
+
+func Test_Parallel01(t *testing.T) {
+	s := NewStorage(100, 10, time.Second, NoEvict[string])
+
+	ts := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				counter, _, _, _ := s.HitBegin("test1-"+strconv.Itoa(j%4), ts)
+				s.HitEnd(counter, ts, ts, nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var hits int64
+	for _, v := range s.Stats(ts, LessHits[string]) {
+		assert.Assert(t, v.Stat.Pending == 0, v)
+		hits += v.Stat.Hits
+	}
+	assert.Assert(t, hits == 16000, hits)
+}
+
+func Benchmark_StorageSamePage(b *testing.B) {
+	s := NewStorage(100, 64, time.Second, NoEvict[string])
+	ts := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter, _, _, _ := s.HitBegin("page", ts)
+			s.HitEnd(counter, ts, ts.Add(time.Millisecond), nil)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"sync"
+	"time"
+)
+
+// removes pages without pending requests and without hits since ts-idle, evict callback is called for each page
+func (self *Storage_t[Key_t]) HitEvictIdle(ts time.Time, idle time.Duration) (count int) {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	self.pages.Range(
+		func(key Key_t, value *Counter_t) bool {
+			value.mx.Lock()
+			begin := value.hit_begin_ts
+			value.mx.Unlock()
+			if value.pending.Load() == 0 && ts.Sub(begin) > idle {
+				self.pages.Remove(key)
+				self.forget(key)
+				self.evict(key, value)
+				count++
+			}
+			return true
+		},
+	)
+	return
+}
+
+func (self *Sharded_t[Key_t]) HitEvictIdle(ts time.Time, idle time.Duration) (count int) {
+	for _, v := range self.shards {
+		count += v.HitEvictIdle(ts, idle)
+	}
+	return
+}
+
+type EvictIdle interface {
+	HitEvictIdle(ts time.Time, idle time.Duration) (count int)
+	HitEvictMemory() (count int)
+	Now() time.Time
+}
+
+type Sweeper_t struct {
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// calls HitEvictIdle with storage clock and HitEvictMemory every interval until Stop
+func NewSweeper(storage EvictIdle, interval time.Duration, idle time.Duration) (self *Sweeper_t) {
+	self = &Sweeper_t{
+		done: make(chan struct{}),
+	}
+	self.wg.Add(1)
+	go self.run(storage, interval, idle)
+	return
+}
+
+func (self *Sweeper_t) run(storage EvictIdle, interval time.Duration, idle time.Duration) {
+	defer self.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.done:
+			return
+		case <-ticker.C:
+			storage.HitEvictIdle(storage.Now(), idle)
+			storage.HitEvictMemory()
+		}
+	}
+}
+
+func (self *Sweeper_t) Stop() {
+	close(self.done)
+	self.wg.Wait()
+}
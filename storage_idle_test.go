@@ -0,0 +1,53 @@
+//
+// go test -run Test_Idle -v -count=1
+//
+
+package ministat
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Idle01(t *testing.T) {
+	var evicted []string
+	s := NewStorage(100, 10, time.Second, func(page string, value *Counter_t) { evicted = append(evicted, page) })
+
+	ts := time.Now()
+	counter, _, _, _ := s.HitBegin("old", ts)
+	s.HitEnd(counter, ts, ts, nil)
+	s.HitBegin("pending", ts)
+	s.HitBegin("new", ts.Add(time.Hour))
+
+	count := s.HitEvictIdle(ts.Add(time.Hour), time.Minute)
+	assert.Assert(t, count == 1, count)
+	assert.DeepEqual(t, evicted, []string{"old"})
+
+	_, ok := s.HitGet(ts, "old")
+	assert.Assert(t, ok == false)
+	_, ok = s.HitGet(ts, "pending")
+	assert.Assert(t, ok)
+
+	// page is created again
+	_, _, pending, _ := s.HitBegin("old", ts.Add(time.Hour))
+	assert.Assert(t, pending == 1, pending)
+}
+
+func Test_Idle02(t *testing.T) {
+	s := NewSharded(4, 100, 10, time.Second, NoEvict[string])
+	ts := time.Now().Add(-time.Hour)
+	counter, _, _, _ := s.HitBegin("page", ts)
+	s.HitEnd(counter, ts, ts, nil)
+
+	sweeper := NewSweeper(s, time.Millisecond, time.Minute)
+	defer sweeper.Stop()
+	for i := 0; i < 100; i++ {
+		if _, ok := s.HitGet(time.Now(), "page"); ok == false {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("page not evicted")
+}
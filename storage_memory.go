@@ -0,0 +1,165 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"sort"
+	"time"
+	"unsafe"
+
+	"github.com/ondi/go-cache"
+)
+
+// median windows are not shrunk below
+const MEDIAN_LIMIT_MIN = 16
+
+// approximate cost of map entry and pointers around value
+const map_entry_size = 48
+
+// nil is 0
+func median_memory(in *Median_t[time.Duration]) int64 {
+	if in == nil {
+		return 0
+	}
+	return int64(unsafe.Sizeof(Median_t[time.Duration]{})) + int64(in.Size())*int64(unsafe.Sizeof(cache.Value_t[int, MedianMapped_t[time.Duration]]{})+map_entry_size)
+}
+
+func (self *Counter_t) memory() (res int64) {
+	self.mx.Lock()
+	res = int64(unsafe.Sizeof(Counter_t{}) + unsafe.Sizeof(Average_t[time.Duration]{}))
+	res += median_memory(self.median) + median_memory(self.queue_wait) + median_memory(self.passed) + median_memory(self.codel)
+	res += int64(self.average.Size()) * int64(unsafe.Sizeof(cache.Value_t[time.Time, AverageMapped_t[time.Duration]]{})+map_entry_size)
+	for k := range self.tags {
+		res += int64(unsafe.Sizeof(Tag_t{})+8+map_entry_size) + int64(len(k.Key)+len(k.Level))
+	}
+	self.mx.Unlock()
+	return
+}
+
+func (self *Storage_t[Key_t]) page_memory(value *Counter_t) int64 {
+	return value.memory() + int64(unsafe.Sizeof(cache.Value_t[Key_t, *Counter_t]{})+2*map_entry_size)
+}
+
+func (self *Storage_t[Key_t]) memory() (res int64) {
+	self.pages.Range(
+		func(key Key_t, value *Counter_t) bool {
+			res += self.page_memory(value)
+			return true
+		},
+	)
+	if self.rollup != nil {
+		res += self.rollup.total.memory()
+		for _, v := range self.rollup.classes {
+			res += v.memory()
+		}
+	}
+	return
+}
+
+// estimated bytes used by pages, strings inside keys are not counted
+func (self *Storage_t[Key_t]) Memory() (res int64) {
+	self.mx.Lock()
+	res = self.memory()
+	self.mx.Unlock()
+	return
+}
+
+func (self *Storage_t[Key_t]) GaugeMemory() Gauge {
+	return Gauge_t[int64]{Name: "memory", Value: self.Memory()}
+}
+
+// 0 = no limit. new page adds its size to estimate and memory is checked only when estimate is over limit.
+// growth of existing pages is found by HitEvictMemory, Sweeper_t calls it every interval.
+// median windows are halved down to MEDIAN_LIMIT_MIN first, then least used pages are evicted.
+// has to be called before use.
+func (self *Storage_t[Key_t]) SetMemoryLimit(limit int64) {
+	self.memory_limit = limit
+	self.memory_used = self.Memory()
+}
+
+// checks memory of all pages, returns number of evicted pages
+func (self *Storage_t[Key_t]) HitEvictMemory() (count int) {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	if self.memory_limit > 0 {
+		count = self.enforce_memory(func(Key_t) bool { return false })
+	}
+	return
+}
+
+// skip is for new page, memory_used is updated
+func (self *Storage_t[Key_t]) enforce_memory(skip func(key Key_t) bool) (count int) {
+	res := self.memory()
+	defer func() {
+		self.memory_used = res
+	}()
+	for res > self.memory_limit && self.median_limit/2 >= MEDIAN_LIMIT_MIN {
+		self.median_limit /= 2
+		self.pages.Range(
+			func(key Key_t, value *Counter_t) bool {
+				value.mx.Lock()
+				value.median.Resize(self.median_limit)
+				value.mx.Unlock()
+				return true
+			},
+		)
+		res = self.memory()
+	}
+	if res <= self.memory_limit {
+		return
+	}
+	type page_t struct {
+		key   Key_t
+		value *Counter_t
+	}
+	var pages []page_t
+	self.pages.Range(
+		func(key Key_t, value *Counter_t) bool {
+			if skip(key) == false {
+				pages = append(pages, page_t{key: key, value: value})
+			}
+			return true
+		},
+	)
+	sort.SliceStable(pages, func(i int, j int) bool {
+		return pages[i].value.CounterGet() < pages[j].value.CounterGet()
+	})
+	for _, v := range pages {
+		if res <= self.memory_limit {
+			return
+		}
+		res -= self.page_memory(v.value)
+		self.pages.Remove(v.key)
+		self.forget(v.key)
+		self.evict(v.key, v.value)
+		count++
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) Memory() (res int64) {
+	for _, v := range self.shards {
+		res += v.Memory()
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) HitEvictMemory() (count int) {
+	for _, v := range self.shards {
+		count += v.HitEvictMemory()
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) GaugeMemory() Gauge {
+	return Gauge_t[int64]{Name: "memory", Value: self.Memory()}
+}
+
+// limit is divided between shards
+func (self *Sharded_t[Key_t]) SetMemoryLimit(limit int64) {
+	for _, v := range self.shards {
+		v.SetMemoryLimit(limit / int64(len(self.shards)))
+	}
+}
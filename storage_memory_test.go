@@ -0,0 +1,94 @@
+//
+// go test -run Test_Memory -v -count=1
+//
+
+package ministat
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func fill_pages(s *Storage_t[string], ts time.Time, pages int, hits int) {
+	for i := 0; i < pages; i++ {
+		for j := 0; j < hits; j++ {
+			counter, _, _, _ := s.HitBegin("page-"+strconv.Itoa(i), ts)
+			s.HitEnd(counter, ts, ts.Add(time.Duration(j)), map[string]map[string]int64{"CODE": {"200": 1}})
+		}
+	}
+}
+
+func Test_Memory01(t *testing.T) {
+	ts := time.Now()
+	s := NewStorage(1000, 128, time.Minute, NoEvict[string])
+	fill_pages(s, ts, 10, 128)
+	full := s.Memory()
+	assert.Assert(t, full > 10*128*int64(map_entry_size), full)
+	assert.Assert(t, s.GaugeMemory().GetValueInt64() == full)
+
+	// existing pages grow over limit, median windows are shrunk first
+	s = NewStorage(1000, 128, time.Minute, NoEvict[string])
+	s.SetMemoryLimit(full / 2)
+	fill_pages(s, ts, 10, 128)
+	assert.Assert(t, s.Memory() > full/2, s.Memory())
+	assert.Assert(t, s.HitEvictMemory() == 0)
+	assert.Assert(t, s.median_limit < 128, s.median_limit)
+	assert.Assert(t, s.pages.Size() == 10, s.pages.Size())
+	assert.Assert(t, s.Memory() <= full/2, s.Memory())
+
+	// least used pages are evicted
+	var evicted []string
+	s = NewStorage(1000, 16, time.Minute, func(page string, value *Counter_t) { evicted = append(evicted, page) })
+	fill_pages(s, ts, 10, 16)
+	limit := s.Memory()
+	s.SetMemoryLimit(limit)
+	s.HitBegin("new", ts)
+	assert.Assert(t, s.median_limit == 16, s.median_limit)
+	assert.Assert(t, len(evicted) == 1, evicted)
+	assert.Assert(t, s.Memory() <= limit, s.Memory())
+	_, ok := s.HitGet(ts, "new")
+	assert.Assert(t, ok)
+}
+
+// tags of existing pages grow over limit, sweeper evicts least used pages
+func Test_Memory02(t *testing.T) {
+	ts := time.Now()
+	var mx sync.Mutex
+	var evicted []string
+	s := NewStorage(1000, 16, time.Minute, func(page string, value *Counter_t) {
+		mx.Lock()
+		evicted = append(evicted, page)
+		mx.Unlock()
+	})
+	fill_pages(s, ts, 10, 16)
+	limit := s.Memory()
+	s.SetMemoryLimit(limit)
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 100; j++ {
+			counter, _, _, _ := s.HitBegin("page-"+strconv.Itoa(i), ts)
+			s.HitEnd(counter, ts, ts, map[string]map[string]int64{"CODE": {strconv.Itoa(j): 1}})
+		}
+	}
+	assert.Assert(t, s.Memory() > limit, s.Memory())
+
+	sweeper := NewSweeper(s, 10*time.Millisecond, time.Hour)
+	for i := 0; i < 100 && s.Memory() > limit; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sweeper.Stop()
+	assert.Assert(t, s.Memory() <= limit, s.Memory())
+	mx.Lock()
+	defer mx.Unlock()
+	assert.Assert(t, len(evicted) > 0, evicted)
+	for i, v := range evicted {
+		_, ok := s.HitGet(ts, v)
+		assert.Assert(t, ok == false, v)
+		// pages without tags are used less
+		n, _ := strconv.Atoi(v[len("page-"):])
+		assert.Assert(t, i >= 5 || n >= 5, evicted)
+	}
+}
@@ -0,0 +1,53 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"fmt"
+)
+
+// sums hits, pending, sampling and tags, merges latency windows
+func (self *Counter_t) Merge(in CounterSnapshot_t) {
+	self.hits.Add(in.Hits)
+	self.pending.Add(in.Pending)
+	self.sampling.Add(in.Sampling)
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	self.median.Merge(in.Median)
+	self.average.Merge(in.Average)
+	for _, v := range in.Tags {
+		self.tags[Tag_t{Key: v.Key, Level: v.Level}] += v.Value
+	}
+	if self.hit_begin_ts.Before(in.HitBeginTs) {
+		self.hit_begin_ts = in.HitBeginTs
+	}
+	if self.hit_end_ts.Before(in.HitEndTs) {
+		self.hit_end_ts = in.HitEndTs
+		self.hit_end_med = in.HitEndMed
+		self.hit_end_avg = in.HitEndAvg
+		self.hit_end_max = in.HitEndMax
+		self.hit_end_size = in.HitEndSize
+	}
+}
+
+func (self *Storage_t[Key_t]) Merge(in StorageSnapshot_t[Key_t]) (err error) {
+	if in.Version != SNAPSHOT_VERSION {
+		return fmt.Errorf("snapshot version: %v, expected: %v", in.Version, SNAPSHOT_VERSION)
+	}
+	self.mx.Lock()
+	for _, v := range in.Pages {
+		// create() counts page once
+		counter := self.create(v.Page)
+		counter.CounterAdd(-1)
+		counter.Merge(v.Counter)
+	}
+	if self.rollup != nil {
+		for k, v := range in.Rollups {
+			self.rollup.counter(self, k).Merge(v)
+		}
+	}
+	self.mx.Unlock()
+	return
+}
@@ -0,0 +1,66 @@
+//
+// go test -run Test_Merge -v -count=1
+//
+
+package ministat
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Merge01(t *testing.T) {
+	ts := time.Now()
+	s1 := NewStorage(100, 100, 10*time.Second, NoEvict[string])
+	s2 := NewStorage(100, 100, 10*time.Second, NoEvict[string])
+	for i := 0; i < 10; i++ {
+		counter, _, _, _ := s1.HitBegin("page", ts)
+		s1.HitEnd(counter, ts, ts.Add(10*time.Millisecond), map[string]map[string]int64{"CODE": {"200": 1}})
+	}
+	for i := 0; i < 5; i++ {
+		counter, _, _, _ := s2.HitBegin("page", ts)
+		s2.HitEnd(counter, ts, ts.Add(40*time.Millisecond), map[string]map[string]int64{"CODE": {"500": 1}})
+	}
+	s2.HitBegin("page", ts)
+
+	s := NewStorage(100, 100, 10*time.Second, NoEvict[string])
+	assert.NilError(t, s.Merge(s1.Snapshot(ts)))
+	assert.NilError(t, s.Merge(s2.Snapshot(ts)))
+
+	res, ok := s.HitGet(ts, "page")
+	assert.Assert(t, ok)
+	values := map[string]int64{}
+	for _, v := range res.GaugeCurrent {
+		values[v.GetName()+v.GetTag()] = v.GetValueInt64()
+	}
+	assert.Assert(t, values["hits"] == 16, values)
+	assert.Assert(t, values["pending"] == 1, values)
+	assert.Assert(t, values["rpm"] == 16, values)
+	assert.Assert(t, values["latency/size"] == 15, values)
+	assert.Assert(t, values["latency/med"] == int64(10*time.Millisecond), values)
+	assert.Assert(t, values["latency/max"] == int64(40*time.Millisecond), values)
+	assert.Assert(t, values["tag200"] == 10, values)
+	assert.Assert(t, values["tag500"] == 5, values)
+}
+
+func Test_Merge02(t *testing.T) {
+	ts := time.Now()
+	m1 := NewMedian[int](10, 10*time.Second)
+	m2 := NewMedian[int](10, 10*time.Second)
+	for i := 0; i < 10; i++ {
+		m1.Add(ts, 1)
+		ts = ts.Add(time.Millisecond)
+		m2.Add(ts, 2)
+		ts = ts.Add(time.Millisecond)
+	}
+	m1.Merge(m2.Snapshot(ts))
+	check := debug_state(m1, ts)
+	assert.Assert(t, len(check) == 0, check)
+	_, avg, max, size := m1.Value(ts)
+	assert.Assert(t, size == 10, size)
+	assert.Assert(t, max == 2, max)
+	// the newest 10 of 20 values: five of each
+	assert.Assert(t, avg == 1, avg)
+}
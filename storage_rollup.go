@@ -0,0 +1,200 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"time"
+)
+
+// class name of rollup over all pages
+const ROLLUP_TOTAL = "*"
+
+// example for Page_t
+func RollupPage(class string) Page_t {
+	return Page_t{Entry: class, Name: ROLLUP_TOTAL}
+}
+
+// counters are never evicted, guarded by Storage_t.mx
+type rollup_t[Key_t comparable] struct {
+	class   PageClass_t[Key_t]
+	total   *Counter_t
+	classes map[string]*Counter_t
+}
+
+func (self *rollup_t[Key_t]) get(storage *Storage_t[Key_t], page Key_t) (out []*Counter_t) {
+	out = append(out, self.total)
+	if self.class != nil {
+		out = append(out, self.counter(storage, self.class(page)))
+	}
+	return
+}
+
+// by class name, created if not exists
+func (self *rollup_t[Key_t]) counter(storage *Storage_t[Key_t], class string) (counter *Counter_t) {
+	if class == ROLLUP_TOTAL {
+		return self.total
+	}
+	counter, ok := self.classes[class]
+	if ok == false {
+		counter = storage.new_counter()
+		self.classes[class] = counter
+	}
+	return
+}
+
+// counts hits of all pages and of every class, class may be nil.
+// rollups are saved in snapshots and restored or merged by storage with rollup.
+// has to be called before first hit.
+func (self *Storage_t[Key_t]) SetRollup(class PageClass_t[Key_t]) {
+	self.rollup = &rollup_t[Key_t]{
+		class:   class,
+		total:   self.new_counter(),
+		classes: map[string]*Counter_t{},
+	}
+}
+
+func (self *Storage_t[Key_t]) rollup_get(class string) (counter *Counter_t, ok bool) {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	if self.rollup == nil {
+		return
+	}
+	if class == ROLLUP_TOTAL {
+		return self.rollup.total, true
+	}
+	counter, ok = self.rollup.classes[class]
+	return
+}
+
+// class is ROLLUP_TOTAL for all pages
+func (self *Storage_t[Key_t]) HitStatRollup(ts time.Time, class string) (out Stat_t, ok bool) {
+	counter, ok := self.rollup_get(class)
+	if ok {
+		out = ToStat(counter, ts)
+	}
+	return
+}
+
+func (self *Storage_t[Key_t]) HitGetRollup(ts time.Time, class string) (out Result_t, ok bool) {
+	res, ok := self.HitStatRollup(ts, class)
+	if ok {
+		out = res.Result()
+	}
+	return
+}
+
+// ROLLUP_TOTAL first
+func (self *Storage_t[Key_t]) rollup_classes() (out []string) {
+	self.mx.Lock()
+	if self.rollup != nil {
+		out = append(out, ROLLUP_TOTAL)
+		for k := range self.rollup.classes {
+			out = append(out, k)
+		}
+	}
+	self.mx.Unlock()
+	return
+}
+
+func (self *Storage_t[Key_t]) RangeRollup(ts time.Time, f func(class string, res Stat_t) bool) {
+	for _, class := range self.rollup_classes() {
+		if res, ok := self.HitStatRollup(ts, class); ok && f(class, res) == false {
+			return
+		}
+	}
+}
+
+// reports pages and rollups, rollup may be nil.
+// memory gauge is appended to gauges of rollup(ROLLUP_TOTAL)
+func (self *Storage_t[Key_t]) HitViews(ts time.Time, views Views[Key_t], rollup func(class string) Key_t) (err error) {
+	for page, res := range self.AllStat(ts) {
+		if e := views.HitCurrent(page, res.GaugeCurrent()); e != nil {
+			err = e
+		}
+	}
+	if rollup == nil {
+		return
+	}
+	self.RangeRollup(ts, func(class string, res Stat_t) bool {
+		g := res.GaugeCurrent()
+		if class == ROLLUP_TOTAL {
+			g = append(g, self.GaugeMemory())
+		}
+		if e := views.HitCurrent(rollup(class), g); e != nil {
+			err = e
+		}
+		return true
+	})
+	return
+}
+
+func (self *Sharded_t[Key_t]) SetRollup(class PageClass_t[Key_t]) {
+	for _, v := range self.shards {
+		v.SetRollup(class)
+	}
+}
+
+// merges rollups of all shards
+func (self *Sharded_t[Key_t]) HitStatRollup(ts time.Time, class string) (out Stat_t, ok bool) {
+	temp := self.shards[0].new_counter()
+	for _, v := range self.shards {
+		if counter, found := v.rollup_get(class); found {
+			temp.Merge(counter.Snapshot(ts))
+			ok = true
+		}
+	}
+	if ok {
+		out = ToStat(temp, ts)
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) HitGetRollup(ts time.Time, class string) (out Result_t, ok bool) {
+	res, ok := self.HitStatRollup(ts, class)
+	if ok {
+		out = res.Result()
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) RangeRollup(ts time.Time, f func(class string, res Stat_t) bool) {
+	var classes []string
+	seen := map[string]bool{}
+	for _, shard := range self.shards {
+		for _, class := range shard.rollup_classes() {
+			if seen[class] == false {
+				seen[class] = true
+				classes = append(classes, class)
+			}
+		}
+	}
+	for _, class := range classes {
+		if res, ok := self.HitStatRollup(ts, class); ok && f(class, res) == false {
+			return
+		}
+	}
+}
+
+func (self *Sharded_t[Key_t]) HitViews(ts time.Time, views Views[Key_t], rollup func(class string) Key_t) (err error) {
+	for page, res := range self.AllStat(ts) {
+		if e := views.HitCurrent(page, res.GaugeCurrent()); e != nil {
+			err = e
+		}
+	}
+	if rollup == nil {
+		return
+	}
+	self.RangeRollup(ts, func(class string, res Stat_t) bool {
+		g := res.GaugeCurrent()
+		if class == ROLLUP_TOTAL {
+			g = append(g, self.GaugeMemory())
+		}
+		if e := views.HitCurrent(rollup(class), g); e != nil {
+			err = e
+		}
+		return true
+	})
+	return
+}
@@ -0,0 +1,110 @@
+//
+// go test -run Test_Rollup -v -count=1
+//
+
+package ministat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+type views_test_t map[Page_t][]Gauge
+
+func (self views_test_t) HitCurrent(page Page_t, g []Gauge) (err error) {
+	self[page] = g
+	return
+}
+
+func Test_Rollup01(t *testing.T) {
+	s := NewStorage(2, 10, 10*time.Second, NoEvict[Page_t])
+	s.SetRollup(PageEntry)
+
+	ts := time.Now()
+	for i := 0; i < 10; i++ {
+		page := Page_t{Entry: "entry-" + strconv.Itoa(i%2), Name: strconv.Itoa(i)}
+		counter, _, _, _ := s.HitBegin(page, ts)
+		s.HitEnd(counter, ts, ts.Add(time.Millisecond), map[string]map[string]int64{"CODE": {"200": 1}})
+	}
+	s.HitBegin(Page_t{Entry: "entry-0", Name: "pending"}, ts)
+
+	total, ok := s.HitStatRollup(ts, ROLLUP_TOTAL)
+	assert.Assert(t, ok)
+	assert.Assert(t, total.Hits == 11, total.Hits)
+	assert.Assert(t, total.Pending == 1, total.Pending)
+	assert.Assert(t, total.Rpm == 11, total.Rpm)
+	assert.Assert(t, total.Latency.Size == 10, total.Latency)
+	assert.Assert(t, total.Tags[0].Value == 10, total.Tags)
+
+	entry, ok := s.HitStatRollup(ts, "entry-1")
+	assert.Assert(t, ok)
+	assert.Assert(t, entry.Hits == 5, entry.Hits)
+
+	_, ok = s.HitStatRollup(ts, "entry-2")
+	assert.Assert(t, ok == false)
+
+	views := views_test_t{}
+	assert.NilError(t, s.HitViews(ts, views, RollupPage))
+	// 2 pages and 3 rollups
+	assert.Assert(t, len(views) == 5, views)
+	assert.Assert(t, views[RollupPage(ROLLUP_TOTAL)][1].GetValueInt64() == 11, views)
+	assert.Assert(t, views[RollupPage("entry-0")][1].GetValueInt64() == 6, views)
+	// memory is last
+	memory := views[RollupPage(ROLLUP_TOTAL)]
+	assert.Assert(t, memory[len(memory)-1].GetName() == "memory", memory)
+}
+
+func Test_Rollup02(t *testing.T) {
+	s := NewSharded(4, 100, 10, 10*time.Second, NoEvict[Page_t])
+	s.SetRollup(PageEntry)
+
+	ts := time.Now()
+	for i := 0; i < 10; i++ {
+		counter, _, _, _ := s.HitBegin(Page_t{Entry: "entry", Name: strconv.Itoa(i)}, ts)
+		s.HitEnd(counter, ts, ts.Add(time.Millisecond), nil)
+	}
+
+	var classes []string
+	s.RangeRollup(ts, func(class string, res Stat_t) bool {
+		assert.Assert(t, res.Hits == 10, res.Hits)
+		classes = append(classes, class)
+		return true
+	})
+	assert.DeepEqual(t, classes, []string{ROLLUP_TOTAL, "entry"})
+}
+
+// rollups survive snapshot when pages are evicted
+func Test_Rollup03(t *testing.T) {
+	s := NewStorage(2, 10, 10*time.Second, NoEvict[Page_t])
+	s.SetRollup(PageEntry)
+
+	ts := time.Now()
+	for i := 0; i < 10; i++ {
+		counter, _, _, _ := s.HitBegin(Page_t{Entry: "entry-" + strconv.Itoa(i%2), Name: strconv.Itoa(i)}, ts)
+		s.HitEnd(counter, ts, ts.Add(time.Millisecond), nil)
+	}
+	snapshot := s.Snapshot(ts)
+	assert.Assert(t, len(snapshot.Pages) == 2, snapshot.Pages)
+	assert.Assert(t, len(snapshot.Rollups) == 3, snapshot.Rollups)
+
+	s = NewStorage(2, 10, 10*time.Second, NoEvict[Page_t])
+	s.SetRollup(PageEntry)
+	assert.NilError(t, s.Restore(snapshot))
+	res, ok := s.HitStatRollup(ts, ROLLUP_TOTAL)
+	assert.Assert(t, ok && res.Hits == 10, res)
+	res, ok = s.HitStatRollup(ts, "entry-1")
+	assert.Assert(t, ok && res.Hits == 5, res)
+
+	// merged by sharded storage
+	sharded := NewSharded(4, 100, 10, 10*time.Second, NoEvict[Page_t])
+	sharded.SetRollup(PageEntry)
+	assert.NilError(t, sharded.Merge(snapshot))
+	assert.NilError(t, sharded.Merge(s.Snapshot(ts)))
+	res, ok = sharded.HitStatRollup(ts, ROLLUP_TOTAL)
+	assert.Assert(t, ok && res.Hits == 20, res)
+	snapshot = sharded.Snapshot(ts)
+	assert.Assert(t, snapshot.Rollups["entry-0"].Hits == 10, snapshot.Rollups)
+}
@@ -0,0 +1,229 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"iter"
+	"time"
+
+	"github.com/ondi/go-cache"
+)
+
+// same API as Storage_t, every shard has own lock and own page limit
+type Sharded_t[Key_t comparable] struct {
+	seed   maphash.Seed
+	shards []*Storage_t[Key_t]
+}
+
+// limit_pages is divided between shards
+func NewSharded[Key_t comparable](shards int, limit_pages int, median_limit int, median_ttl time.Duration, evict func(page Key_t, value *Counter_t)) (self *Sharded_t[Key_t]) {
+	if shards < 1 {
+		shards = 1
+	}
+	self = &Sharded_t[Key_t]{
+		seed: maphash.MakeSeed(),
+	}
+	for i := 0; i < shards; i++ {
+		storage := NewStorage(
+			(limit_pages+shards-1)/shards,
+			median_limit,
+			median_ttl,
+			evict,
+		)
+		storage.shard = i
+		self.shards = append(self.shards, storage)
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) get(name Key_t) *Storage_t[Key_t] {
+	return self.shards[maphash.Comparable(self.seed, name)%uint64(len(self.shards))]
+}
+
+// has to be called before use
+func (self *Sharded_t[Key_t]) SetClock(clock Clock) {
+	for _, v := range self.shards {
+		v.SetClock(clock)
+	}
+}
+
+func (self *Sharded_t[Key_t]) Now() time.Time {
+	return self.shards[0].Now()
+}
+
+func (self *Sharded_t[Key_t]) HitBegin(name Key_t, begin time.Time) (counter *Counter_t, sampling int64, pending int64, rpm int64) {
+	return self.get(name).HitBegin(name, begin)
+}
+
+func (self *Sharded_t[Key_t]) HitEnd(counter *Counter_t, begin time.Time, end time.Time, tags map[string]map[string]int64) {
+	self.shards[counter.shard].HitEnd(counter, begin, end, tags)
+}
+
+func (self *Sharded_t[Key_t]) HitGet(ts time.Time, name Key_t) (out Result_t, ok bool) {
+	return self.get(name).HitGet(ts, name)
+}
+
+func (self *Sharded_t[Key_t]) HitRemove(name Key_t) (ok bool) {
+	return self.get(name).HitRemove(name)
+}
+
+func (self *Sharded_t[Key_t]) HitRemoveRange(cmp func(Key_t) bool) {
+	for _, v := range self.shards {
+		v.HitRemoveRange(cmp)
+	}
+}
+
+// copies results of one shard at a time, pages are ordered within shard only
+func (self *Sharded_t[Key_t]) Range(ts time.Time, f func(name Key_t, res Result_t) bool) {
+	for _, shard := range self.shards {
+		for _, v := range ToResults(shard.Stats(ts, nil)) {
+			if f(v.Page, v.Result) == false {
+				return
+			}
+		}
+	}
+}
+
+// copies pages one shard at a time, sorts between shards, f is called without lock
+func (self *Sharded_t[Key_t]) RangeSort(ts time.Time, order cache.Less_t[Key_t, *Counter_t], f func(name Key_t, res Result_t) bool) {
+	for _, v := range self.Results(ts, order) {
+		if f(v.Page, v.Result) == false {
+			return
+		}
+	}
+}
+
+func (self *Sharded_t[Key_t]) HitStat(ts time.Time, name Key_t) (out Stat_t, ok bool) {
+	return self.get(name).HitStat(ts, name)
+}
+
+// order may be nil
+func (self *Sharded_t[Key_t]) Results(ts time.Time, order cache.Less_t[Key_t, *Counter_t]) (out []PageResult_t[Key_t]) {
+	return ToResults(self.Stats(ts, order))
+}
+
+// copies pages under lock of one shard at a time, stats are taken under lock of each counter.
+// order may be nil
+func (self *Sharded_t[Key_t]) Stats(ts time.Time, order cache.Less_t[Key_t, *Counter_t]) (out []PageStat_t[Key_t]) {
+	temp := cache.New[Key_t, *Counter_t]()
+	for _, v := range self.shards {
+		v.mx.Lock()
+		v.pages.Range(
+			func(key Key_t, value *Counter_t) bool {
+				temp.CreateBack(key, func(p **Counter_t) { *p = value }, func(p **Counter_t) {})
+				return true
+			},
+		)
+		v.mx.Unlock()
+	}
+	if order != nil {
+		temp.InsertionSortBack(order)
+	}
+	out = make([]PageStat_t[Key_t], 0, temp.Size())
+	for it := temp.Front(); it != temp.End(); it = it.Next() {
+		out = append(out, PageStat_t[Key_t]{Page: it.Key, Stat: ToStat(it.Value, ts)})
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) All(ts time.Time) iter.Seq2[Key_t, Result_t] {
+	return func(yield func(Key_t, Result_t) bool) {
+		self.Range(ts, yield)
+	}
+}
+
+func (self *Sharded_t[Key_t]) AllStat(ts time.Time) iter.Seq2[Key_t, Stat_t] {
+	return func(yield func(Key_t, Stat_t) bool) {
+		for _, shard := range self.shards {
+			for _, v := range shard.Stats(ts, nil) {
+				if yield(v.Page, v.Stat) == false {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (self *Sharded_t[Key_t]) Sorted(ts time.Time, order cache.Less_t[Key_t, *Counter_t]) iter.Seq2[Key_t, Result_t] {
+	return func(yield func(Key_t, Result_t) bool) {
+		self.RangeSort(ts, order, yield)
+	}
+}
+
+func (self *Sharded_t[Key_t]) Snapshot(ts time.Time) (out StorageSnapshot_t[Key_t]) {
+	out.Version = SNAPSHOT_VERSION
+	out.Ts = ts
+	rollups := map[string]*Counter_t{}
+	for _, v := range self.shards {
+		temp := v.Snapshot(ts)
+		out.Pages = append(out.Pages, temp.Pages...)
+		for class, rollup := range temp.Rollups {
+			counter, ok := rollups[class]
+			if ok == false {
+				counter = v.new_counter()
+				rollups[class] = counter
+			}
+			counter.Merge(rollup)
+		}
+	}
+	if len(rollups) > 0 {
+		out.Rollups = map[string]CounterSnapshot_t{}
+		for k, v := range rollups {
+			out.Rollups[k] = v.Snapshot(ts)
+		}
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) split(in StorageSnapshot_t[Key_t]) (out []StorageSnapshot_t[Key_t], err error) {
+	if in.Version != SNAPSHOT_VERSION {
+		err = fmt.Errorf("snapshot version: %v, expected: %v", in.Version, SNAPSHOT_VERSION)
+		return
+	}
+	out = make([]StorageSnapshot_t[Key_t], len(self.shards))
+	for _, v := range in.Pages {
+		shard := self.get(v.Page).shard
+		out[shard].Pages = append(out[shard].Pages, v)
+	}
+	// rollups of shards are merged on read, so all go to first shard
+	out[0].Rollups = in.Rollups
+	for i := range out {
+		out[i].Version = in.Version
+		out[i].Ts = in.Ts
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) Restore(in StorageSnapshot_t[Key_t]) (err error) {
+	temp, err := self.split(in)
+	for i := 0; i < len(temp) && err == nil; i++ {
+		err = self.shards[i].Restore(temp[i])
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) Merge(in StorageSnapshot_t[Key_t]) (err error) {
+	temp, err := self.split(in)
+	for i := 0; i < len(temp) && err == nil; i++ {
+		err = self.shards[i].Merge(temp[i])
+	}
+	return
+}
+
+func (self *Sharded_t[Key_t]) WriteSnapshot(out io.Writer, ts time.Time) (err error) {
+	return json.NewEncoder(out).Encode(self.Snapshot(ts))
+}
+
+func (self *Sharded_t[Key_t]) ReadSnapshot(in io.Reader) (err error) {
+	var temp StorageSnapshot_t[Key_t]
+	if err = json.NewDecoder(in).Decode(&temp); err != nil {
+		return
+	}
+	return self.Restore(temp)
+}
@@ -0,0 +1,79 @@
+//
+// go test -run Test_Sharded -v -count=1
+// go test -run NONE -bench Parallel -cpu 64
+//
+
+package ministat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Sharded01(t *testing.T) {
+	s := NewSharded(8, 1000, 10, time.Second, NoEvict[string])
+
+	ts := time.Now()
+	for i := 0; i < 100; i++ {
+		counter, _, _, _ := s.HitBegin("page-"+strconv.Itoa(i), ts)
+		s.HitEnd(counter, ts, ts.Add(time.Duration(i)*time.Millisecond), nil)
+	}
+
+	res, ok := s.HitGet(ts, "page-10")
+	assert.Assert(t, ok)
+	assert.Assert(t, res.GaugeLast[4].GetValueInt64() == int64(10*time.Millisecond), res.GaugeLast)
+
+	var count int
+	prev := time.Hour
+	// descending
+	s.RangeSort(ts, LessDuration[string], func(name string, res Result_t) bool {
+		med := time.Duration(res.GaugeCurrent[4].GetValueInt64())
+		assert.Assert(t, med <= prev, "%v %v", med, prev)
+		prev = med
+		count++
+		return true
+	})
+	assert.Assert(t, count == 100, count)
+
+	count = 0
+	s.Range(ts, func(name string, res Result_t) bool {
+		count++
+		return count < 10
+	})
+	assert.Assert(t, count == 10, count)
+
+	s.HitRemoveRange(func(name string) bool { return name != "page-10" })
+	snapshot := s.Snapshot(ts)
+	assert.Assert(t, len(snapshot.Pages) == 1, len(snapshot.Pages))
+}
+
+func bench_keys(n int) (res []string) {
+	for i := 0; i < n; i++ {
+		res = append(res, "/api/page-"+strconv.Itoa(i))
+	}
+	return
+}
+
+func bench_parallel(b *testing.B, s Storage[string]) {
+	keys := bench_keys(1024)
+	ts := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			counter, _, _, _ := s.HitBegin(keys[i%len(keys)], ts)
+			s.HitEnd(counter, ts, ts.Add(time.Millisecond), nil)
+			i += 7
+		}
+	})
+}
+
+func Benchmark_StorageParallel(b *testing.B) {
+	bench_parallel(b, NewStorage(4096, 64, time.Second, NoEvict[string]))
+}
+
+func Benchmark_ShardedParallel(b *testing.B) {
+	bench_parallel(b, NewSharded(64, 4096, 64, time.Second, NoEvict[string]))
+}
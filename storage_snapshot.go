@@ -0,0 +1,133 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const SNAPSHOT_VERSION = 1
+
+type CounterSnapshot_t struct {
+	Median     MedianSnapshot_t[time.Duration]  `json:"median"`
+	Average    AverageSnapshot_t[time.Duration] `json:"average"`
+	Tags       []TagValue_t                     `json:"tags"`
+	HitBeginTs time.Time                        `json:"hit_begin_ts"`
+	HitEndTs   time.Time                        `json:"hit_end_ts"`
+	HitEndMed  time.Duration                    `json:"hit_end_med"`
+	HitEndAvg  time.Duration                    `json:"hit_end_avg"`
+	HitEndMax  time.Duration                    `json:"hit_end_max"`
+	HitEndSize int                              `json:"hit_end_size"`
+	Hits       int64                            `json:"hits"`
+	Pending    int64                            `json:"pending"`
+	Sampling   int64                            `json:"sampling"`
+}
+
+type PageSnapshot_t[Key_t comparable] struct {
+	Page    Key_t             `json:"page"`
+	Counter CounterSnapshot_t `json:"counter"`
+}
+
+type StorageSnapshot_t[Key_t comparable] struct {
+	Version int                          `json:"version"`
+	Ts      time.Time                    `json:"ts"`
+	Pages   []PageSnapshot_t[Key_t]      `json:"pages"`
+	Rollups map[string]CounterSnapshot_t `json:"rollups,omitempty"` // by class, ROLLUP_TOTAL for all pages
+}
+
+func (self *Counter_t) Snapshot(ts time.Time) (out CounterSnapshot_t) {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	out = CounterSnapshot_t{
+		Median:     self.median.Snapshot(ts),
+		Average:    self.average.Snapshot(ts),
+		HitBeginTs: self.hit_begin_ts,
+		HitEndTs:   self.hit_end_ts,
+		HitEndMed:  self.hit_end_med,
+		HitEndAvg:  self.hit_end_avg,
+		HitEndMax:  self.hit_end_max,
+		HitEndSize: self.hit_end_size,
+		Hits:       self.hits.Load(),
+		Pending:    self.pending.Load(),
+		Sampling:   self.sampling.Load(),
+	}
+	for k, v := range self.tags {
+		out.Tags = append(out.Tags, TagValue_t{Key: k.Key, Level: k.Level, Value: v})
+	}
+	return
+}
+
+// pending requests of previous process will never end, so pending is not restored
+func (self *Counter_t) Restore(in CounterSnapshot_t) {
+	self.hits.Store(in.Hits)
+	self.sampling.Store(in.Sampling)
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	self.median.Restore(in.Median)
+	self.average.Restore(in.Average)
+	self.tags = map[Tag_t]int64{}
+	for _, v := range in.Tags {
+		self.tags[Tag_t{Key: v.Key, Level: v.Level}] += v.Value
+	}
+	self.hit_begin_ts = in.HitBeginTs
+	self.hit_end_ts = in.HitEndTs
+	self.hit_end_med = in.HitEndMed
+	self.hit_end_avg = in.HitEndAvg
+	self.hit_end_max = in.HitEndMax
+	self.hit_end_size = in.HitEndSize
+}
+
+func (self *Storage_t[Key_t]) Snapshot(ts time.Time) (out StorageSnapshot_t[Key_t]) {
+	out.Version = SNAPSHOT_VERSION
+	out.Ts = ts
+	self.mx.Lock()
+	self.pages.Range(
+		func(key Key_t, value *Counter_t) bool {
+			out.Pages = append(out.Pages, PageSnapshot_t[Key_t]{Page: key, Counter: value.Snapshot(ts)})
+			return true
+		},
+	)
+	if self.rollup != nil {
+		out.Rollups = map[string]CounterSnapshot_t{ROLLUP_TOTAL: self.rollup.total.Snapshot(ts)}
+		for k, v := range self.rollup.classes {
+			out.Rollups[k] = v.Snapshot(ts)
+		}
+	}
+	self.mx.Unlock()
+	return
+}
+
+// pages not present in snapshot are kept, rollups are restored if SetRollup is called
+func (self *Storage_t[Key_t]) Restore(in StorageSnapshot_t[Key_t]) (err error) {
+	if in.Version != SNAPSHOT_VERSION {
+		return fmt.Errorf("snapshot version: %v, expected: %v", in.Version, SNAPSHOT_VERSION)
+	}
+	self.mx.Lock()
+	for _, v := range in.Pages {
+		self.create(v.Page).Restore(v.Counter)
+	}
+	if self.rollup != nil {
+		for k, v := range in.Rollups {
+			self.rollup.counter(self, k).Restore(v)
+		}
+	}
+	self.mx.Unlock()
+	return
+}
+
+func (self *Storage_t[Key_t]) WriteSnapshot(out io.Writer, ts time.Time) (err error) {
+	return json.NewEncoder(out).Encode(self.Snapshot(ts))
+}
+
+func (self *Storage_t[Key_t]) ReadSnapshot(in io.Reader) (err error) {
+	var temp StorageSnapshot_t[Key_t]
+	if err = json.NewDecoder(in).Decode(&temp); err != nil {
+		return
+	}
+	return self.Restore(temp)
+}
@@ -0,0 +1,75 @@
+//
+// go test -run Test_Snapshot -v -count=1
+//
+
+package ministat
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Snapshot01(t *testing.T) {
+	s1 := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+
+	ts := time.Now()
+	for i := 0; i < 20; i++ {
+		page := Page_t{Entry: "entry", Name: fmt.Sprintf("page-%d", i%3)}
+		counter, _, _, _ := s1.HitBegin(page, ts)
+		s1.HitEnd(counter, ts, ts.Add(time.Duration(i)*time.Millisecond), map[string]map[string]int64{"CODE": {"200": 1}})
+		ts = ts.Add(100 * time.Millisecond)
+	}
+	s1.HitBegin(Page_t{Entry: "entry", Name: "pending"}, ts)
+
+	var buf bytes.Buffer
+	err := s1.WriteSnapshot(&buf, ts)
+	assert.NilError(t, err)
+
+	s2 := NewStorage(100, 10, 10*time.Second, NoEvict[Page_t])
+	err = s2.ReadSnapshot(&buf)
+	assert.NilError(t, err)
+
+	s1.Range(ts, func(page Page_t, res1 Result_t) bool {
+		res2, ok := s2.HitGet(ts, page)
+		assert.Assert(t, ok, page)
+		assert.Assert(t, res1.BeginTs.Equal(res2.BeginTs), page)
+		assert.Assert(t, res1.EndTs.Equal(res2.EndTs), page)
+		assert.Assert(t, len(res1.GaugeCurrent) == len(res2.GaugeCurrent), page)
+		for i := range res1.GaugeCurrent {
+			if res1.GaugeCurrent[i].GetName() == "pending" {
+				assert.Assert(t, res2.GaugeCurrent[i].GetValueInt64() == 0, res2.GaugeCurrent[i])
+				continue
+			}
+			assert.Assert(t, res1.GaugeCurrent[i].String() == res2.GaugeCurrent[i].String(), "%v %v", res1.GaugeCurrent[i], res2.GaugeCurrent[i])
+			assert.Assert(t, res1.GaugeLast[i].String() == res2.GaugeLast[i].String(), "%v %v", res1.GaugeLast[i], res2.GaugeLast[i])
+		}
+		return true
+	})
+}
+
+func Test_Snapshot02(t *testing.T) {
+	s := NewStorage(100, 10, 10*time.Second, NoEvict[string])
+	err := s.ReadSnapshot(bytes.NewBufferString(`{"version":0}`))
+	assert.ErrorContains(t, err, "version")
+}
+
+func Test_Snapshot03(t *testing.T) {
+	ts := time.Now()
+	m1 := NewMedian[int](11, 10*time.Second)
+	for i := 0; i < 100; i++ {
+		m1.Add(ts, i%17)
+		ts = ts.Add(time.Second)
+	}
+	m2 := NewMedian[int](11, 10*time.Second)
+	m2.Restore(m1.Snapshot(ts))
+	check := debug_state(m2, ts)
+	assert.Assert(t, len(check) == 0, check)
+
+	med1, avg1, max1, size1 := m1.Value(ts)
+	med2, avg2, max2, size2 := m2.Value(ts)
+	assert.Assert(t, med1 == med2 && avg1 == avg2 && max1 == max2 && size1 == size2, "%v %v %v %v", med2, avg2, max2, size2)
+}
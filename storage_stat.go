@@ -0,0 +1,179 @@
+//
+//
+//
+
+package ministat
+
+import (
+	"sort"
+	"time"
+)
+
+type TagValue_t struct {
+	Key   string `json:"key"`
+	Level string `json:"level"`
+	Value int64  `json:"value"`
+}
+
+type Latency_t struct {
+	Med  time.Duration `json:"med"`
+	Avg  time.Duration `json:"avg"`
+	Max  time.Duration `json:"max"`
+	Size int           `json:"size"`
+}
+
+// typed form of Result_t
+type Stat_t struct {
+	BeginTs     time.Time     `json:"begin_ts"`
+	EndTs       time.Time     `json:"end_ts"`
+	Rpm         int64         `json:"rpm"`
+	Hits        int64         `json:"hits"`
+	Pending     int64         `json:"pending"`
+	Sampling    int64         `json:"sampling"`
+	Idle        time.Duration `json:"idle"`
+	Latency     Latency_t     `json:"latency"`        // current window
+	LatencyLast Latency_t     `json:"latency_last"`   // at last HitEnd
+	Limit       int64         `json:"limit,omitzero"` // set by Limiter
+	Queue       int64         `json:"queue,omitzero"`
+	QueueWait   Latency_t     `json:"queue_wait,omitzero"`
+	Tags        []TagValue_t  `json:"tags"` // sorted by value descending
+}
+
+func ToStat(in *Counter_t, ts time.Time) (out Stat_t) {
+	out.Hits = in.hits.Load()
+	out.Pending = in.pending.Load()
+	out.Sampling = in.sampling.Load()
+	in.mx.Lock()
+	defer in.mx.Unlock()
+	out.BeginTs = in.hit_begin_ts
+	out.EndTs = in.hit_end_ts
+	_, out.Rpm = in.average.Value(ts)
+	out.Idle = ts.Sub(in.hit_begin_ts)
+	out.Latency.Med, out.Latency.Avg, out.Latency.Max, out.Latency.Size = in.median.Value(ts)
+	out.Limit = int64(in.limit)
+	out.Queue = in.queue.Load()
+	if in.queue_wait != nil {
+		out.QueueWait.Med, out.QueueWait.Avg, out.QueueWait.Max, out.QueueWait.Size = in.queue_wait.Value(ts)
+	}
+	out.LatencyLast = Latency_t{Med: in.hit_end_med, Avg: in.hit_end_avg, Max: in.hit_end_max, Size: in.hit_end_size}
+	if len(in.tags) > 0 {
+		out.Tags = make([]TagValue_t, 0, len(in.tags))
+		for k, v := range in.tags {
+			out.Tags = append(out.Tags, TagValue_t{Key: k.Key, Level: k.Level, Value: v})
+		}
+		sort.Slice(out.Tags, func(i int, j int) bool {
+			a, b := out.Tags[i], out.Tags[j]
+			return a.Value > b.Value ||
+				a.Value == b.Value && a.Level > b.Level ||
+				a.Value == b.Value && a.Level == b.Level && a.Key > b.Key
+		})
+	}
+	return
+}
+
+// limit is reported only if set by Limiter, queue only if used
+func (self Stat_t) gauges(latency Latency_t) (out []Gauge) {
+	out = make([]Gauge, 0, 14+len(self.Tags))
+	out = append(out,
+		Gauge_t[int64]{Name: "rpm", Value: self.Rpm},
+		Gauge_t[int64]{Name: "hits", Value: self.Hits},
+		Gauge_t[int64]{Name: "pending", Value: self.Pending},
+		Gauge_t[time.Duration]{Name: "idle", Value: self.Idle},
+		Gauge_t[time.Duration]{Name: "latency/med", Value: latency.Med},
+		Gauge_t[time.Duration]{Name: "latency/avg", Value: latency.Avg},
+		Gauge_t[time.Duration]{Name: "latency/max", Value: latency.Max},
+		Gauge_t[int64]{Name: "latency/size", Value: int64(latency.Size)},
+	)
+	if self.Limit > 0 {
+		out = append(out, Gauge_t[int64]{Name: "limit", Value: self.Limit})
+	}
+	if self.Queue > 0 || self.QueueWait.Size > 0 {
+		out = append(out,
+			Gauge_t[int64]{Name: "queue", Value: self.Queue},
+			Gauge_t[time.Duration]{Name: "queue/med", Value: self.QueueWait.Med},
+			Gauge_t[time.Duration]{Name: "queue/avg", Value: self.QueueWait.Avg},
+			Gauge_t[time.Duration]{Name: "queue/max", Value: self.QueueWait.Max},
+			Gauge_t[int64]{Name: "queue/size", Value: int64(self.QueueWait.Size)},
+		)
+	}
+	for _, v := range self.Tags {
+		out = append(out, Gauge_t[int64]{Name: "tag", Level: v.Level, Tag: v.Key, Value: v.Value})
+	}
+	return
+}
+
+func (self Stat_t) GaugeCurrent() []Gauge {
+	return self.gauges(self.Latency)
+}
+
+func (self Stat_t) GaugeLast() []Gauge {
+	return self.gauges(self.LatencyLast)
+}
+
+func (self Stat_t) Result() Result_t {
+	return Result_t{
+		BeginTs:      self.BeginTs,
+		EndTs:        self.EndTs,
+		GaugeCurrent: self.GaugeCurrent(),
+		GaugeLast:    self.GaugeLast(),
+	}
+}
+
+func ToResult(in *Counter_t, ts time.Time) (out Result_t) {
+	return ToStat(in, ts).Result()
+}
+
+func ToResults[Key_t comparable](in []PageStat_t[Key_t]) (out []PageResult_t[Key_t]) {
+	out = make([]PageResult_t[Key_t], 0, len(in))
+	for _, v := range in {
+		out = append(out, PageResult_t[Key_t]{Page: v.Page, Result: v.Stat.Result()})
+	}
+	return
+}
+
+// value of gauge by name, level and tag are used for "tag" only
+func (self Stat_t) Value(name string, level string, tag string) (res float64, ok bool) {
+	ok = true
+	switch name {
+	case "rpm":
+		res = float64(self.Rpm)
+	case "hits":
+		res = float64(self.Hits)
+	case "pending":
+		res = float64(self.Pending)
+	case "sampling":
+		res = float64(self.Sampling)
+	case "idle":
+		res = float64(self.Idle)
+	case "latency/med":
+		res = float64(self.Latency.Med)
+	case "latency/avg":
+		res = float64(self.Latency.Avg)
+	case "latency/max":
+		res = float64(self.Latency.Max)
+	case "latency/size":
+		res = float64(self.Latency.Size)
+	case "limit":
+		res = float64(self.Limit)
+	case "queue":
+		res = float64(self.Queue)
+	case "queue/med":
+		res = float64(self.QueueWait.Med)
+	case "queue/avg":
+		res = float64(self.QueueWait.Avg)
+	case "queue/max":
+		res = float64(self.QueueWait.Max)
+	case "queue/size":
+		res = float64(self.QueueWait.Size)
+	case "tag":
+		for _, v := range self.Tags {
+			if v.Level == level && v.Key == tag {
+				return float64(v.Value), true
+			}
+		}
+		ok = false
+	default:
+		ok = false
+	}
+	return
+}
@@ -0,0 +1,66 @@
+//
+// go test -run Test_Stat -v -count=1
+// go test -run NONE -bench Hit -benchmem
+//
+
+package ministat
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func Test_Stat01(t *testing.T) {
+	s := NewStorage(10, 10, 10*time.Second, NoEvict[string])
+
+	ts := time.Now()
+	for i := 1; i <= 3; i++ {
+		counter, _, _, _ := s.HitBegin("page", ts)
+		s.HitEnd(counter, ts, ts.Add(time.Duration(i)*time.Millisecond), map[string]map[string]int64{"CODE": {"200": 1}})
+	}
+	s.HitBegin("page", ts)
+
+	res, ok := s.HitStat(ts, "page")
+	assert.Assert(t, ok)
+	assert.Assert(t, res.Hits == 4, res.Hits)
+	assert.Assert(t, res.Pending == 1, res.Pending)
+	assert.Assert(t, res.Rpm == 4, res.Rpm)
+	assert.Assert(t, res.Latency.Med == 2*time.Millisecond, res.Latency)
+	assert.Assert(t, res.Latency.Max == 3*time.Millisecond, res.Latency)
+	assert.Assert(t, res.Latency.Size == 3, res.Latency)
+	assert.Assert(t, res.LatencyLast == res.Latency, res.LatencyLast)
+	assert.Assert(t, len(res.Tags) == 1 && res.Tags[0] == TagValue_t{Key: "200", Level: "CODE", Value: 3}, res.Tags)
+
+	gauges := res.GaugeCurrent()
+	assert.Assert(t, len(gauges) == 9, gauges)
+	assert.Assert(t, gauges[4].GetName() == "latency/med" && gauges[4].GetValueInt64() == int64(2*time.Millisecond), gauges[4])
+	assert.Assert(t, gauges[8].String() == "{tag:CODE:200:3}", gauges[8])
+}
+
+func bench_storage() (s *Storage_t[string], ts time.Time) {
+	s = NewStorage(10, 100, 10*time.Second, NoEvict[string])
+	ts = time.Now()
+	for i := 0; i < 100; i++ {
+		counter, _, _, _ := s.HitBegin("page", ts)
+		s.HitEnd(counter, ts, ts.Add(time.Millisecond), map[string]map[string]int64{"CODE": {"200": 1}})
+	}
+	return
+}
+
+func Benchmark_HitGet(b *testing.B) {
+	s, ts := bench_storage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.HitGet(ts, "page")
+	}
+}
+
+func Benchmark_HitStat(b *testing.B) {
+	s, ts := bench_storage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.HitStat(ts, "page")
+	}
+}